@@ -1,25 +1,238 @@
 package appconfig
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/joho/godotenv"
+	"github.com/rx3lixir/crawler/dates"
+	"github.com/rx3lixir/crawler/scheduler"
+	"io/fs"
+	"math"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type AppConfig struct {
 	TelegramToken string `json:"telegram_token"`
 	GoogleAuthKey string `json:"google_auth_key"`
 	SpreadsheetID string `json:"spreadsheet_id"`
+	// Timezone is used to interpret event dates, e.g. "Europe/Moscow"
+	Timezone string `json:"timezone"`
+	// StorePath is the location of the local database with run history
+	StorePath string `json:"store_path"`
+	// Sinks lists where results are written, Google Sheets if empty
+	Sinks []SinkConfig `json:"sinks"`
+	// SheetWriteMode is one of "overwrite" (default), "append" or "upsert"
+	SheetWriteMode string `json:"sheet_write_mode"`
+	// SheetColumns defines the spreadsheet columns in order, a default layout if empty
+	SheetColumns []ColumnConfig `json:"sheet_columns"`
+	// CreateMissingSheets adds a sheet for every event type that doesn't have one yet
+	CreateMissingSheets bool `json:"create_missing_sheets"`
+	// Access lists the Telegram users and chats allowed to use the bot
+	Access []AccessEntry `json:"access"`
+	// Schedules lists recurring crawls that exist regardless of bot commands
+	Schedules []ScheduleConfig `json:"schedules"`
+	// AlertChatID is the Telegram chat that receives selector drift alerts.
+	// If it isn't set, the alerts go to the admins listed in Access
+	AlertChatID int64 `json:"alert_chat_id"`
+	// Drift tunes selector drift detection
+	Drift DriftConfig `json:"drift"`
+	// RateLimit limits requests to each host, SiteConfig.RateLimit overrides it per site
+	RateLimit RateLimit `json:"rate_limit"`
+	// UserAgent is sent with requests and matched against robots.txt, a default if empty
+	UserAgent string `json:"user_agent"`
+	// Retry tunes how failed requests to sites and Google Sheets are repeated
+	Retry RetryConfig `json:"retry"`
+	// SiteTimeoutSeconds bounds the crawl of one site, SiteConfig.TimeoutSeconds overrides it.
+	// A default applies if zero, negative disables the deadline
+	SiteTimeoutSeconds int `json:"site_timeout_seconds"`
+	// RunTimeoutSeconds bounds the crawl of all sites, same rules as SiteTimeoutSeconds
+	RunTimeoutSeconds int `json:"run_timeout_seconds"`
+}
+
+// RetryConfig is the retry policy shared by all outbound calls. Zero values fall back to defaults.
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts per call, 1 disables retries
+	MaxAttempts int `json:"max_attempts"`
+	// BaseDelayMs is the pause after the first failure, doubled after each next one
+	BaseDelayMs int `json:"base_delay_ms"`
+	// MaxDelayMs caps the pause, a longer Retry-After from the server stops retrying
+	MaxDelayMs int `json:"max_delay_ms"`
+	// Jitter is the random fraction of each pause, from 0 to 1, negative disables it
+	Jitter float64 `json:"jitter"`
+}
+
+// RateLimit is a politeness policy for a single host. Zero values fall back to
+// the global settings and then to defaults.
+type RateLimit struct {
+	// RequestsPerSecond is the token bucket refill rate, negative disables rate limiting
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// Burst is the number of requests that can be made at once after a pause
+	Burst int `json:"burst"`
+	// MaxConcurrency caps simultaneous requests to the host, negative disables the cap
+	MaxConcurrency int `json:"max_concurrency"`
+}
+
+// check returns the field of the first invalid setting and what is wrong with it.
+// Negative rates and concurrency are valid, they disable the limit.
+func (r RateLimit) check() (string, string) {
+	switch {
+	case math.IsNaN(r.RequestsPerSecond) || math.IsInf(r.RequestsPerSecond, 0):
+		return "RequestsPerSecond", "must be a finite number"
+	case r.Burst < 0:
+		return "Burst", "must not be negative"
+	}
+	return "", ""
+}
+
+// DriftConfig tunes how a site's latest results are compared with its history.
+// Zero values fall back to defaults.
+type DriftConfig struct {
+	// Disabled turns drift detection off
+	Disabled bool `json:"disabled"`
+	// Window is the number of previous runs of a site averaged into the baseline
+	Window int `json:"window"`
+	// MinRuns is the number of previous runs needed before a site is checked
+	MinRuns int `json:"min_runs"`
+	// CountDrop is the relative drop of the event count that raises an alert, e.g. 0.5
+	CountDrop float64 `json:"count_drop"`
+	// FillDrop is the relative drop of a field's fill rate that raises an alert
+	FillDrop float64 `json:"fill_drop"`
+}
+
+// ScheduleConfig runs the crawl of a chat on a schedule.
+type ScheduleConfig struct {
+	ChatID int64 `json:"chat_id"`
+	// Spec is a cron expression or "@every <duration>"
+	Spec string `json:"spec"`
+}
+
+// Bot roles, each one includes the permissions of the previous
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// AccessEntry grants a role to a Telegram user or to everyone in a chat.
+// Exactly one of UserID and ChatID is set.
+type AccessEntry struct {
+	UserID int64  `json:"user_id,omitempty"`
+	ChatID int64  `json:"chat_id,omitempty"`
+	Role   string `json:"role"`
+}
+
+// ColumnConfig maps an event field to a spreadsheet column.
+type ColumnConfig struct {
+	// Field is one of title, date, location, link, event_type, price,
+	// description, start, end, source
+	Field string `json:"field"`
+	// Header is the label written in the header row, the field name if empty
+	Header string `json:"header"`
+	// DateFormat is a Go time layout used for the start and end fields
+	DateFormat string `json:"date_format"`
+	// Hyperlink makes the cell a link to the event page
+	Hyperlink bool `json:"hyperlink"`
+}
+
+// Supported spreadsheet write modes
+const (
+	WriteModeOverwrite = "overwrite"
+	WriteModeAppend    = "append"
+	WriteModeUpsert    = "upsert"
+)
+
+// Supported uses of schema.org structured data
+const (
+	// StructuredFill completes the fields that the selectors left empty
+	StructuredFill = "fill"
+	// StructuredOnly takes events from structured data instead of the selectors
+	StructuredOnly = "only"
+)
+
+// Built-in render modes of SiteConfig.Render
+const (
+	// RenderBrowser renders pages through the Puppeteer service
+	RenderBrowser = "browser"
+	// RenderStatic downloads pages with a plain HTTP GET
+	RenderStatic = "static"
+)
+
+var (
+	rendersMu sync.RWMutex
+	renders   = map[string]bool{RenderBrowser: true, RenderStatic: true}
+)
+
+// RegisterRender adds a render mode that site configurations may use,
+// for fetchers registered in addition to the built-in ones.
+func RegisterRender(render string) {
+	rendersMu.Lock()
+	defer rendersMu.Unlock()
+	renders[render] = true
+}
+
+// knownRender reports whether a render mode is built in or registered.
+func knownRender(render string) bool {
+	rendersMu.RLock()
+	defer rendersMu.RUnlock()
+	return renders[render]
+}
+
+// Supported sink types
+const (
+	SinkSheets    = "sheets"
+	SinkCSV       = "csv"
+	SinkJSONLines = "jsonl"
+	SinkBolt      = "bolt"
+)
+
+// SinkConfig describes one destination for scraped events.
+type SinkConfig struct {
+	Type string `json:"type"`
+	// Path is the output file for file-based sinks
+	Path string `json:"path"`
 }
 
 var CrawlerApp *AppConfig
 
-func LoadConfig(configPath string) error {
+const defaultStorePath = "crawler.db"
+
+// LoadOptions tell LoadConfig which credentials the current command needs.
+type LoadOptions struct {
+	// RequireTelegram requires the bot token
+	RequireTelegram bool
+	// RequireSheets requires Google credentials even if no sheets sink is configured
+	RequireSheets bool
+	// Sinks, if not nil, replace the sinks from the config
+	Sinks []SinkConfig
+	// NoSinks is set by commands that don't write results, so sink credentials aren't required
+	NoSinks bool
+}
+
+// LoadConfig loads the configuration from a file, or from the environment if
+// configPath is empty, and validates it. Google credentials are only required
+// when opts asks for them or the Sheets sink is used.
+func LoadConfig(configPath string, opts LoadOptions) error {
+	var err error
 	if configPath != "" {
-		return loadConfigFromFile(configPath)
+		err = loadConfigFromFile(configPath)
+	} else {
+		err = loadConfigFromEnv()
 	}
-	return loadConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	if opts.Sinks != nil {
+		CrawlerApp.Sinks = opts.Sinks
+	}
+	return validateConfig(opts)
 }
 
 func loadConfigFromFile(configPath string) error {
@@ -34,31 +247,188 @@ func loadConfigFromFile(configPath string) error {
 	}
 
 	CrawlerApp = config
-	return validateConfig()
+	return nil
 }
 
 func loadConfigFromEnv() error {
+	// The .env file is optional, variables may come from the environment itself
 	err := godotenv.Load()
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("Error loading .env file: %v", err)
 	}
 
 	CrawlerApp = &AppConfig{
-		TelegramToken: os.Getenv("TELEGRAM_TOKEN"),
-		GoogleAuthKey: os.Getenv("GOOGLE_AUTH_KEY"),
-		SpreadsheetID: os.Getenv("SPREADSHEET_ID"),
+		TelegramToken:       os.Getenv("TELEGRAM_TOKEN"),
+		GoogleAuthKey:       os.Getenv("GOOGLE_AUTH_KEY"),
+		SpreadsheetID:       os.Getenv("SPREADSHEET_ID"),
+		Timezone:            os.Getenv("TIMEZONE"),
+		StorePath:           os.Getenv("STORE_PATH"),
+		Sinks:               parseSinks(os.Getenv("SINKS")),
+		SheetWriteMode:      os.Getenv("SHEET_WRITE_MODE"),
+		CreateMissingSheets: os.Getenv("CREATE_MISSING_SHEETS") == "true",
+		Access:              parseAdmins(os.Getenv("ADMIN_IDS")),
+		UserAgent:           os.Getenv("USER_AGENT"),
 	}
 
-	return validateConfig()
+	// The same settings as in the config file, unset variables keep the defaults
+	return readEnvSettings([]envSetting{
+		{"ALERT_CHAT_ID", &CrawlerApp.AlertChatID},
+		{"SHEET_COLUMNS", &CrawlerApp.SheetColumns},
+		{"SCHEDULES", &CrawlerApp.Schedules},
+		{"DRIFT_DISABLED", &CrawlerApp.Drift.Disabled},
+		{"DRIFT_WINDOW", &CrawlerApp.Drift.Window},
+		{"DRIFT_MIN_RUNS", &CrawlerApp.Drift.MinRuns},
+		{"DRIFT_COUNT_DROP", &CrawlerApp.Drift.CountDrop},
+		{"DRIFT_FILL_DROP", &CrawlerApp.Drift.FillDrop},
+		{"RATE_LIMIT_RPS", &CrawlerApp.RateLimit.RequestsPerSecond},
+		{"RATE_LIMIT_BURST", &CrawlerApp.RateLimit.Burst},
+		{"RATE_LIMIT_MAX_CONCURRENCY", &CrawlerApp.RateLimit.MaxConcurrency},
+		{"RETRY_MAX_ATTEMPTS", &CrawlerApp.Retry.MaxAttempts},
+		{"RETRY_BASE_DELAY_MS", &CrawlerApp.Retry.BaseDelayMs},
+		{"RETRY_MAX_DELAY_MS", &CrawlerApp.Retry.MaxDelayMs},
+		{"RETRY_JITTER", &CrawlerApp.Retry.Jitter},
+		{"SITE_TIMEOUT_SECONDS", &CrawlerApp.SiteTimeoutSeconds},
+		{"RUN_TIMEOUT_SECONDS", &CrawlerApp.RunTimeoutSeconds},
+	})
+}
+
+// envSetting is an optional environment variable and the setting it fills.
+// Lists such as SHEET_COLUMNS and SCHEDULES are given as JSON, like in the config file.
+type envSetting struct {
+	name   string
+	target interface{}
+}
+
+// readEnvSettings parses the environment variables that are set into their settings.
+func readEnvSettings(settings []envSetting) error {
+	for _, setting := range settings {
+		value := strings.TrimSpace(os.Getenv(setting.name))
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch target := setting.target.(type) {
+		case *int:
+			*target, err = strconv.Atoi(value)
+		case *int64:
+			*target, err = strconv.ParseInt(value, 10, 64)
+		case *float64:
+			*target, err = strconv.ParseFloat(value, 64)
+		case *bool:
+			*target, err = strconv.ParseBool(value)
+		default:
+			err = json.Unmarshal([]byte(value), target)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", setting.name, err)
+		}
+	}
+	return nil
 }
 
-func validateConfig() error {
-	if CrawlerApp.TelegramToken == "" || CrawlerApp.GoogleAuthKey == "" || CrawlerApp.SpreadsheetID == "" {
-		return fmt.Errorf("incomplete configuration: missing required values")
+func validateConfig(opts LoadOptions) error {
+	if opts.RequireTelegram && CrawlerApp.TelegramToken == "" {
+		return fmt.Errorf("incomplete configuration: missing telegram token")
+	}
+	if (opts.RequireSheets || !opts.NoSinks && CrawlerApp.UsesSheets()) && (CrawlerApp.GoogleAuthKey == "" || CrawlerApp.SpreadsheetID == "") {
+		return fmt.Errorf("incomplete configuration: missing Google auth key or spreadsheet ID")
+	}
+	if _, err := CrawlerApp.Location(); err != nil {
+		return err
+	}
+	if CrawlerApp.StorePath == "" {
+		CrawlerApp.StorePath = defaultStorePath
+	}
+	switch CrawlerApp.SheetWriteMode {
+	case "":
+		CrawlerApp.SheetWriteMode = WriteModeOverwrite
+	case WriteModeOverwrite, WriteModeAppend, WriteModeUpsert:
+	default:
+		return fmt.Errorf("unknown sheet write mode %q", CrawlerApp.SheetWriteMode)
+	}
+	for i, entry := range CrawlerApp.Access {
+		if (entry.UserID == 0) == (entry.ChatID == 0) {
+			return fmt.Errorf("access entry %d: exactly one of user_id and chat_id must be set", i)
+		}
+		if !ValidRole(entry.Role) {
+			return fmt.Errorf("access entry %d: unknown role %q", i, entry.Role)
+		}
+	}
+	if drift := CrawlerApp.Drift; drift.Window < 0 || drift.MinRuns < 0 || drift.CountDrop < 0 || drift.CountDrop >= 1 || drift.FillDrop < 0 || drift.FillDrop >= 1 {
+		return fmt.Errorf("invalid drift settings: window and min_runs must not be negative, count_drop and fill_drop must be in [0, 1)")
+	}
+	if field, message := CrawlerApp.RateLimit.check(); field != "" {
+		return fmt.Errorf("invalid rate limit: %s %s", field, message)
+	}
+	if retry := CrawlerApp.Retry; retry.MaxAttempts < 0 || retry.BaseDelayMs < 0 || retry.MaxDelayMs < 0 || retry.Jitter > 1 {
+		return fmt.Errorf("invalid retry settings: max_attempts and delays must not be negative, jitter must not exceed 1")
+	}
+	for i, schedule := range CrawlerApp.Schedules {
+		if schedule.ChatID == 0 {
+			return fmt.Errorf("schedule %d: chat_id is required", i)
+		}
+		if _, err := scheduler.Parse(schedule.Spec); err != nil {
+			return fmt.Errorf("schedule %d: %v", i, err)
+		}
 	}
 	return nil
 }
 
+// UsesSheets reports whether results are written to Google Sheets.
+func (c AppConfig) UsesSheets() bool {
+	if len(c.Sinks) == 0 {
+		return true
+	}
+	for _, sink := range c.Sinks {
+		if sink.Type == SinkSheets {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSinks parses a comma-separated list of sinks in the form "type[:path]",
+// e.g. "sheets,csv:events.csv".
+func parseSinks(value string) []SinkConfig {
+	var sinks []SinkConfig
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		sinkType, path, _ := strings.Cut(item, ":")
+		sinks = append(sinks, SinkConfig{Type: sinkType, Path: path})
+	}
+	return sinks
+}
+
+// parseAdmins parses a comma-separated list of Telegram user IDs that get the admin role.
+func parseAdmins(value string) []AccessEntry {
+	var entries []AccessEntry
+	for _, item := range strings.Split(value, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(item), 10, 64)
+		if err != nil || id == 0 {
+			continue
+		}
+		entries = append(entries, AccessEntry{UserID: id, Role: RoleAdmin})
+	}
+	return entries
+}
+
+// ValidRole reports whether role is one of the known bot roles.
+func ValidRole(role string) bool {
+	return role == RoleViewer || role == RoleOperator || role == RoleAdmin
+}
+
+// Location returns the timezone used to interpret event dates.
+func (c AppConfig) Location() (*time.Location, error) {
+	return dates.LoadLocation(c.Timezone)
+}
+
+// PagePlaceholder is replaced with the page number in SiteConfig.PageURLTemplate
+const PagePlaceholder = "{page}"
+
 type SiteConfig struct {
 	UrlToVisit        string
 	EventType         string
@@ -67,12 +437,68 @@ type SiteConfig struct {
 	DateSelector      string
 	LocationSelector  string
 	LinkSelector      string
+	// Render selects how the page is fetched: "browser" (default) or "static"
+	Render string
+	// Timezone overrides AppConfig.Timezone for this site
+	Timezone string
+	// Structured reads schema.org events from JSON-LD or microdata: "fill" or "only",
+	// off if empty. In "only" mode the listing selectors are not needed
+	Structured string
+
+	// Pagination: a selector for the "next page" link, a URL template with
+	// a {page} placeholder, or both, the template being used on pages without
+	// the link. MaxPages caps the number of visited pages,
+	// StopWhenEmpty stops at the first page without events.
+	NextPageSelector string
+	PageURLTemplate  string
+	MaxPages         int
+	StopWhenEmpty    bool
+
+	// Detail describes how to extract extra fields from each event's own page
+	Detail *DetailConfig
+
+	// RateLimit overrides AppConfig.RateLimit for requests made for this site
+	RateLimit *RateLimit
+	// IgnoreRobots skips robots.txt checks, for sites that allowed us to crawl them
+	IgnoreRobots bool
+	// TimeoutSeconds overrides AppConfig.SiteTimeoutSeconds for this site
+	TimeoutSeconds int
+}
+
+// DetailConfig holds selectors applied to the page behind an event's link.
+// Non-empty values found there replace the ones taken from the listing.
+type DetailConfig struct {
+	TitleSelector       string
+	DateSelector        string
+	LocationSelector    string
+	PriceSelector       string
+	DescriptionSelector string
+	// WaitSelector is passed to the browser renderer, "body" if empty
+	WaitSelector string
+	// Concurrency limits simultaneous detail fetches for one listing
+	Concurrency int
 }
 
 type EventConfig struct {
-	Title     string `json:"title"`
-	Date      string `json:"date"`
-	Location  string `json:"location"`
-	Link      string `json:"link"`
-	EventType string `json:"eventType"`
+	Title       string `json:"title"`
+	Date        string `json:"date"`
+	Location    string `json:"location"`
+	Link        string `json:"link"`
+	EventType   string `json:"eventType"`
+	Price       string `json:"price,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Start and End hold the parsed Date, zero if it couldn't be parsed
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Source is the UrlToVisit of the site configuration that produced the event
+	Source string `json:"source"`
+}
+
+// Fingerprint returns a stable identifier of the event built from its link, title and date.
+func (e EventConfig) Fingerprint() string {
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	}
+	sum := sha1.Sum([]byte(strings.TrimRight(e.Link, "/") + "\n" + normalize(e.Title) + "\n" + normalize(e.Date)))
+	return hex.EncodeToString(sum[:])
 }
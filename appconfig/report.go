@@ -0,0 +1,68 @@
+package appconfig
+
+import "time"
+
+// SiteStatus is the outcome of crawling one site.
+type SiteStatus string
+
+const (
+	// SiteOK means events were found
+	SiteOK SiteStatus = "ok"
+	// SiteEmpty means the site was fetched but no events were found
+	SiteEmpty SiteStatus = "empty"
+	// SitePartial means events were found, but a later page or the deadline stopped the crawl
+	SitePartial SiteStatus = "partial"
+	// SiteFailed means the site couldn't be crawled
+	SiteFailed SiteStatus = "failed"
+	// SiteCancelled means the run was stopped before the site finished
+	SiteCancelled SiteStatus = "cancelled"
+	// SiteSkipped means robots.txt doesn't allow crawling the site
+	SiteSkipped SiteStatus = "skipped"
+)
+
+// ErrorKind classifies why a site failed or returned nothing.
+type ErrorKind string
+
+const (
+	ErrorNetwork       ErrorKind = "network"
+	ErrorHTTPStatus    ErrorKind = "http_status"
+	ErrorRenderTimeout ErrorKind = "render_timeout"
+	ErrorNoMatch       ErrorKind = "no_match"
+	ErrorParse         ErrorKind = "parse"
+	ErrorConfig        ErrorKind = "config"
+	ErrorCancelled     ErrorKind = "cancelled"
+	ErrorTimeout       ErrorKind = "timeout"
+	ErrorDisallowed    ErrorKind = "robots"
+	ErrorUnknown       ErrorKind = "unknown"
+)
+
+// SiteReport describes how the crawl of one site configuration went.
+type SiteReport struct {
+	URL       string        `json:"url"`
+	EventType string        `json:"event_type"`
+	Status    SiteStatus    `json:"status"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	// Pages is the number of listing pages fetched
+	Pages int `json:"pages"`
+	// Retries counts repeated fetches of listing and detail pages
+	Retries int `json:"retries"`
+	Events  int `json:"events"`
+	// Rejected counts matched elements that didn't produce an event
+	Rejected int `json:"rejected"`
+	// Disallowed counts URLs skipped because of robots.txt
+	Disallowed int `json:"disallowed"`
+	// Structured is the SiteConfig.Structured mode the site was crawled with
+	Structured string `json:"structured,omitempty"`
+	// Filled counts events with a non-empty value of each selector-backed field
+	Filled    FieldCounts `json:"filled"`
+	ErrorKind ErrorKind   `json:"error_kind,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// FieldCounts counts events by field. Link only counts events with a link of their own.
+type FieldCounts struct {
+	Title int `json:"title"`
+	Date  int `json:"date"`
+	Link  int `json:"link"`
+}
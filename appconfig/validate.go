@@ -0,0 +1,242 @@
+package appconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/rx3lixir/crawler/dates"
+)
+
+// selectorField is a CSS selector of a site configuration to check.
+type selectorField struct {
+	field    string
+	value    string
+	required bool
+}
+
+// FieldError is a problem with one field of one site configuration.
+type FieldError struct {
+	// Index is the position of the site in the configuration array, -1 for the whole file
+	Index int
+	// Field is the name of the offending field, empty if the problem isn't tied to one
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Index < 0 {
+		return e.Message
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("sites[%d]: %s", e.Index, e.Message)
+	}
+	return fmt.Sprintf("sites[%d].%s: %s", e.Index, e.Field, e.Message)
+}
+
+// ValidationErrors lists every problem found in a site configuration file.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ParseSiteConfigs decodes and validates a JSON array of site configurations,
+// or a single configuration object. Fields that SiteConfig doesn't have are
+// reported instead of being ignored. All problems are returned at once as ValidationErrors.
+func ParseSiteConfigs(data []byte) ([]SiteConfig, error) {
+	var raw []json.RawMessage
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var single json.RawMessage
+		err = json.Unmarshal(data, &single)
+		raw = []json.RawMessage{single}
+	} else {
+		err = json.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, ValidationErrors{{Index: -1, Message: describeJSONError(data, err)}}
+	}
+	if len(raw) == 0 {
+		return nil, ValidationErrors{{Index: -1, Message: "no site configurations in the file"}}
+	}
+
+	var errs ValidationErrors
+	configs := make([]SiteConfig, len(raw))
+	for i, item := range raw {
+		decoder := json.NewDecoder(bytes.NewReader(item))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&configs[i]); err != nil {
+			errs = append(errs, decodeFieldError(i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if errs := ValidateSiteConfigs(configs); len(errs) > 0 {
+		return nil, errs
+	}
+	return configs, nil
+}
+
+// ValidateSiteConfigs checks required fields, URLs, CSS selectors and duplicates.
+func ValidateSiteConfigs(configs []SiteConfig) ValidationErrors {
+	var errs ValidationErrors
+	seen := make(map[string]int)
+
+	for i, config := range configs {
+		add := func(field, format string, args ...interface{}) {
+			errs = append(errs, FieldError{Index: i, Field: field, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if strings.TrimSpace(config.UrlToVisit) == "" {
+			add("UrlToVisit", "is required")
+		} else if err := checkURL(config.UrlToVisit); err != nil {
+			add("UrlToVisit", "%v", err)
+		}
+		if strings.TrimSpace(config.EventType) == "" {
+			add("EventType", "is required")
+		}
+
+		switch config.Structured {
+		case "", StructuredFill, StructuredOnly:
+		default:
+			add("Structured", "must be %q or %q", StructuredFill, StructuredOnly)
+		}
+		if config.Render != "" && !knownRender(config.Render) {
+			add("Render", "unknown render mode %q, expected %q or %q", config.Render, RenderBrowser, RenderStatic)
+		}
+
+		// Without selectors events come from structured data alone
+		needSelectors := config.Structured != StructuredOnly
+
+		selectors := []selectorField{
+			{"AnchestorSelector", config.AnchestorSelector, needSelectors},
+			{"TitleSelector", config.TitleSelector, needSelectors},
+			{"DateSelector", config.DateSelector, needSelectors},
+			{"LinkSelector", config.LinkSelector, false},
+			{"NextPageSelector", config.NextPageSelector, false},
+		}
+		if config.Detail != nil {
+			selectors = append(selectors, []selectorField{
+				{"Detail.TitleSelector", config.Detail.TitleSelector, false},
+				{"Detail.DateSelector", config.Detail.DateSelector, false},
+				{"Detail.LocationSelector", config.Detail.LocationSelector, false},
+				{"Detail.PriceSelector", config.Detail.PriceSelector, false},
+				{"Detail.DescriptionSelector", config.Detail.DescriptionSelector, false},
+				{"Detail.WaitSelector", config.Detail.WaitSelector, false},
+			}...)
+		}
+		for _, selector := range selectors {
+			if strings.TrimSpace(selector.value) == "" {
+				if selector.required {
+					add(selector.field, "is required")
+				}
+				continue
+			}
+			if _, err := cascadia.Compile(selector.value); err != nil {
+				add(selector.field, "invalid CSS selector %q: %v", selector.value, err)
+			}
+		}
+
+		if config.PageURLTemplate != "" {
+			if !strings.Contains(config.PageURLTemplate, PagePlaceholder) {
+				add("PageURLTemplate", "must contain %s", PagePlaceholder)
+			} else if err := checkURL(strings.ReplaceAll(config.PageURLTemplate, PagePlaceholder, "1")); err != nil {
+				add("PageURLTemplate", "%v", err)
+			}
+		}
+		if config.MaxPages < 0 {
+			add("MaxPages", "must not be negative")
+		}
+		if config.Detail != nil && config.Detail.Concurrency < 0 {
+			add("Detail.Concurrency", "must not be negative")
+		}
+		if config.RateLimit != nil {
+			if field, message := config.RateLimit.check(); field != "" {
+				add("RateLimit."+field, "%s", message)
+			}
+		}
+		if config.Timezone != "" {
+			if _, err := dates.LoadLocation(config.Timezone); err != nil {
+				add("Timezone", "%v", err)
+			}
+		}
+
+		// The same page crawled twice for the same sheet only duplicates events
+		key := strings.TrimRight(strings.TrimSpace(config.UrlToVisit), "/") + "\n" + config.EventType
+		if first, ok := seen[key]; ok && config.UrlToVisit != "" {
+			add("", "duplicates sites[%d] (same UrlToVisit and EventType)", first)
+		} else {
+			seen[key] = i
+		}
+	}
+
+	return errs
+}
+
+// checkURL requires an absolute http or https URL.
+func checkURL(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid URL %q: host is missing", raw)
+	}
+	return nil
+}
+
+// decodeFieldError converts an error decoding one array element into a FieldError.
+func decodeFieldError(index int, err error) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return FieldError{Index: index, Field: typeErr.Field, Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	}
+
+	// encoding/json doesn't export a type for unknown fields
+	const unknownPrefix = "json: unknown field "
+	if message := err.Error(); strings.HasPrefix(message, unknownPrefix) {
+		return FieldError{Index: index, Field: strings.Trim(strings.TrimPrefix(message, unknownPrefix), `"`), Message: "unknown field"}
+	}
+
+	return FieldError{Index: index, Message: err.Error()}
+}
+
+// describeJSONError adds the line and column to JSON syntax errors.
+func describeJSONError(data []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, column := position(data, syntaxErr.Offset)
+		return fmt.Sprintf("invalid JSON at line %d, column %d: %v", line, column, err)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field == "" {
+		return "the file must contain a JSON array of site configurations"
+	}
+	return fmt.Sprintf("invalid JSON: %v", err)
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/drift"
+	"github.com/rx3lixir/crawler/output"
+	"github.com/rx3lixir/crawler/pipeline"
+	"github.com/rx3lixir/crawler/spreadsheets"
+	"github.com/rx3lixir/crawler/storage"
+	"github.com/rx3lixir/crawler/telegram"
+	"github.com/rx3lixir/crawler/web"
+)
+
+// newFlagSet creates the flags of a subcommand. Every subcommand also accepts
+// -config so that it can be given after the command name.
+func newFlagSet(name, configFile string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	return flags, flags.String("config", configFile, "Path to config file")
+}
+
+func botCommand(configFile string, args []string) error {
+	flags, configFlag := newFlagSet("bot", configFile)
+	flags.Parse(args)
+
+	if err := appconfig.LoadConfig(*configFlag, appconfig.LoadOptions{RequireTelegram: true}); err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+	fmt.Println("Configuration loaded successfully")
+
+	telegram.StartBot(*appconfig.CrawlerApp)
+	return nil
+}
+
+func runCommand(configFile string, args []string) error {
+	flags, configFlag := newFlagSet("run", configFile)
+	sitesFile := flags.String("sites", "", "Path to the site configurations (required)")
+	out := flags.String("out", "", "Comma-separated output files, the sink is chosen by extension (.csv, .jsonl, .db) or \"sheets\"; sinks from the config if empty")
+	noHistory := flags.Bool("no-history", false, "Don't record the run in the local store")
+	flags.Parse(args)
+
+	if *sitesFile == "" {
+		flags.Usage()
+		return fmt.Errorf("--sites is required")
+	}
+
+	sites, err := readSites(*sitesFile)
+	if err != nil {
+		return err
+	}
+
+	var sinkConfigs []appconfig.SinkConfig
+	if *out != "" {
+		if sinkConfigs, err = sinksFromOut(*out); err != nil {
+			return err
+		}
+	}
+
+	if err := appconfig.LoadConfig(*configFlag, appconfig.LoadOptions{Sinks: sinkConfigs}); err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+	cfg := *appconfig.CrawlerApp
+
+	sinks, err := output.NewSinks(cfg)
+	if err != nil {
+		return err
+	}
+	loc, err := cfg.Location()
+	if err != nil {
+		return err
+	}
+
+	// The history is optional here: the bot may hold the lock on the store
+	var store *storage.Store
+	if !*noHistory {
+		if store, err = storage.Open(cfg.StorePath); err != nil {
+			log.Printf("Warning: run history disabled: %v", err)
+			store = nil
+		} else {
+			defer store.Close()
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := pipeline.Execute(ctx, pipeline.Request{
+		Sites: sites,
+		Store: store,
+		Sinks: sinks,
+		Drift: cfg.Drift,
+		Options: web.Options{
+			Location:    loc,
+			RateLimit:   cfg.RateLimit,
+			UserAgent:   cfg.UserAgent,
+			Retry:       cfg.Retry,
+			SiteTimeout: time.Duration(cfg.SiteTimeoutSeconds) * time.Second,
+			RunTimeout:  time.Duration(cfg.RunTimeoutSeconds) * time.Second,
+			OnSiteDone: func(config appconfig.SiteConfig, report appconfig.SiteReport) {
+				log.Printf("%s: %s, %d events", config.UrlToVisit, report.Status, report.Events)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := printReport(result.Run.Reports)
+	fmt.Printf("\nFound %d events on %d sites\n", len(result.Events), len(sites))
+	if result.Run.ID != 0 {
+		fmt.Printf("Run #%d recorded in %s\n", result.Run.ID, cfg.StorePath)
+	}
+	reportAlerts(cfg, result.Alerts)
+	if result.WriteErr != nil {
+		return fmt.Errorf("error writing results: %v", result.WriteErr)
+	}
+	for _, sink := range cfg.Sinks {
+		if sink.Path != "" {
+			fmt.Printf("Results written to %s\n", sink.Path)
+		}
+	}
+	if cfg.UsesSheets() {
+		fmt.Printf("Results written to https://docs.google.com/spreadsheets/d/%s/edit\n", cfg.SpreadsheetID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sites failed", failed, len(sites))
+	}
+	return nil
+}
+
+// reportAlerts prints selector drift alerts and sends them to the alert chat if one is configured.
+func reportAlerts(cfg appconfig.AppConfig, alerts []drift.Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	fmt.Println("\nSelector drift:")
+	for _, alert := range alerts {
+		fmt.Println("  " + alert.String())
+	}
+
+	if cfg.AlertChatID != 0 && cfg.TelegramToken != "" {
+		if err := telegram.SendAlerts(cfg.TelegramToken, cfg.AlertChatID, alerts); err != nil {
+			log.Printf("Error sending alerts: %v", err)
+		}
+	}
+}
+
+// printReport prints a line per site and returns the number of failed sites.
+func printReport(reports []appconfig.SiteReport) int {
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tEVENTS\tREJECTED\tSKIPPED\tPAGES\tRETRIES\tDURATION\tSITE\tERROR")
+	for _, report := range reports {
+		if report.Status == appconfig.SiteFailed {
+			failed++
+		}
+		problem := ""
+		if report.ErrorKind != "" {
+			problem = fmt.Sprintf("%s: %s", report.ErrorKind, report.Error)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", report.Status, report.Events, report.Rejected, report.Disallowed, report.Pages, report.Retries,
+			report.Duration.Round(time.Millisecond), report.URL, problem)
+	}
+	w.Flush()
+	return failed
+}
+
+func validateCommand(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: crawler validate sites.json")
+	}
+
+	sites, err := readSites(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: %d site configurations are valid\n", flags.Arg(0), len(sites))
+	return nil
+}
+
+func testCommand(configFile string, args []string) error {
+	flags, configFlag := newFlagSet("test", configFile)
+	index := flags.Int("index", 0, "Index of the site in the file")
+	limit := flags.Int("limit", web.DefaultSampleSize, "Number of events to show")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: crawler test [-index N] [-limit N] sites.json")
+	}
+
+	sites, err := readSites(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *index < 0 || *index >= len(sites) {
+		return fmt.Errorf("no site with index %d, the file has %d", *index, len(sites))
+	}
+	site := sites[*index]
+
+	// Only the timezone is needed, credentials are not
+	if err := appconfig.LoadConfig(*configFlag, appconfig.LoadOptions{NoSinks: true}); err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+	loc, err := appconfig.CrawlerApp.Location()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := web.Options{
+		Location:  loc,
+		RateLimit: appconfig.CrawlerApp.RateLimit,
+		UserAgent: appconfig.CrawlerApp.UserAgent,
+		Retry:     appconfig.CrawlerApp.Retry,
+	}
+	report, err := web.DryRun(ctx, site, opts, *limit)
+	if err != nil {
+		return err
+	}
+
+	if site.Structured == appconfig.StructuredOnly {
+		fmt.Printf("%s: %d schema.org events found\n", report.PageURL, report.Matched)
+	} else {
+		fmt.Printf("%s: %d elements matched AnchestorSelector %q\n", report.PageURL, report.Matched, site.AnchestorSelector)
+		if site.Structured != "" {
+			fmt.Printf("%d schema.org events available to fill empty fields\n", report.StructuredEvents)
+		}
+	}
+	for i, sample := range report.Samples {
+		event := sample.Event
+		fmt.Printf("\n%d. %s\n", i+1, event.Title)
+		fmt.Printf("   date:     %s", event.Date)
+		if !event.Start.IsZero() {
+			fmt.Printf(" (%s)", event.Start.Format(time.RFC3339))
+		}
+		fmt.Printf("\n   location: %s\n   link:     %s\n", event.Location, event.Link)
+		if len(sample.EmptySelectors) > 0 {
+			fmt.Printf("   empty:    %s\n", strings.Join(sample.EmptySelectors, ", "))
+		}
+	}
+	if report.NextPageURL != "" {
+		fmt.Printf("\nnext page: %s\n", report.NextPageURL)
+	}
+	return nil
+}
+
+func clearCommand(configFile string, args []string) error {
+	flags, configFlag := newFlagSet("clear", configFile)
+	flags.Parse(args)
+
+	if err := appconfig.LoadConfig(*configFlag, appconfig.LoadOptions{RequireSheets: true}); err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := spreadsheets.ClearAllSheets(ctx, *appconfig.CrawlerApp); err != nil {
+		return err
+	}
+	fmt.Println("All sheets cleared")
+	return nil
+}
+
+// readSites reads a site configuration file in the format accepted by the bot.
+func readSites(path string) ([]appconfig.SiteConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sites file: %v", err)
+	}
+
+	sites, err := appconfig.ParseSiteConfigs(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sites file %s:\n%v", path, err)
+	}
+	return sites, nil
+}
+
+// sinksFromOut maps the --out flag to sink configurations by file extension.
+func sinksFromOut(out string) ([]appconfig.SinkConfig, error) {
+	var sinks []appconfig.SinkConfig
+	for _, path := range strings.Split(out, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if path == appconfig.SinkSheets {
+			sinks = append(sinks, appconfig.SinkConfig{Type: appconfig.SinkSheets})
+			continue
+		}
+
+		var sinkType string
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			sinkType = appconfig.SinkCSV
+		case ".jsonl", ".ndjson":
+			sinkType = appconfig.SinkJSONLines
+		case ".db":
+			sinkType = appconfig.SinkBolt
+		default:
+			return nil, fmt.Errorf("can't tell the output format of %s, use .csv, .jsonl or .db", path)
+		}
+		sinks = append(sinks, appconfig.SinkConfig{Type: sinkType, Path: path})
+	}
+	return sinks, nil
+}
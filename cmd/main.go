@@ -3,21 +3,55 @@ package main
 import (
 	"flag"
 	"fmt"
-	"github.com/rx3lixir/crawler/appconfig"
-	"github.com/rx3lixir/crawler/telegram"
 	"log"
+	"os"
 )
 
+const usage = `Usage: crawler [-config file] <command> [arguments]
+
+Commands:
+  bot                                   start the Telegram bot (default)
+  run --sites sites.json [--out file]   crawl the sites once and write the results
+  validate sites.json                   check a site configuration file
+  test [-index N] sites.json            dry-run one site and show the extracted events
+  clear                                 clear all sheets of the spreadsheet
+`
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
 	configFile := flag.String("config", "", "Path to config file")
 	flag.Parse()
 
-	// Loading data
-	if err := appconfig.LoadConfig(*configFile); err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	command, args := "bot", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
-	fmt.Println("Configuration loaded successfully")
 
-	// Running bot instance
-	telegram.StartBot(*appconfig.CrawlerApp)
+	var err error
+	switch command {
+	case "bot":
+		err = botCommand(*configFile, args)
+	case "run":
+		err = runCommand(*configFile, args)
+	case "validate":
+		err = validateCommand(args)
+	case "test":
+		err = testCommand(*configFile, args)
+	case "clear":
+		err = clearCommand(*configFile, args)
+	case "help", "-h", "--help":
+		flag.Usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("%s: %v", command, err)
+	}
 }
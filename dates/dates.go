@@ -0,0 +1,324 @@
+package dates
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pastTolerance is how far in the past a date without a year may lie before
+// it is considered to belong to the next year.
+const pastTolerance = 30 * 24 * time.Hour
+
+// EventDate is a parsed event date. Single dates have End equal to Start.
+type EventDate struct {
+	Raw     string
+	Start   time.Time
+	End     time.Time
+	HasTime bool
+}
+
+// Parser turns human-readable event dates into time values in a fixed location.
+type Parser struct {
+	Location *time.Location
+	// Now returns the reference time for relative dates and year inference
+	Now func() time.Time
+}
+
+// NewParser creates a Parser for the given location, time.Local if nil.
+func NewParser(location *time.Location) *Parser {
+	if location == nil {
+		location = time.Local
+	}
+	return &Parser{Location: location, Now: time.Now}
+}
+
+// LoadLocation resolves a timezone name, falling back to time.Local for an empty name.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q: %v", name, err)
+	}
+	return location, nil
+}
+
+var isoLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+var (
+	timePattern    = regexp.MustCompile(`\b(\d{1,2}):(\d{2})\b`)
+	numericPattern = regexp.MustCompile(`\b(\d{1,2})\.(\d{1,2})(?:\.(\d{4}|\d{2}))?\b`)
+	dashPattern    = regexp.MustCompile(`\s*[-–—]\s*`)
+	cleanPattern   = regexp.MustCompile(`[,.;()/|]+`)
+)
+
+// monthPrefixes maps month name prefixes to months, covering both nominative
+// and genitive Russian forms as well as English abbreviations.
+var monthPrefixes = []struct {
+	prefix string
+	month  time.Month
+}{
+	{"янв", time.January}, {"фев", time.February}, {"мар", time.March},
+	{"апр", time.April}, {"мая", time.May}, {"май", time.May},
+	{"июн", time.June}, {"июл", time.July}, {"авг", time.August},
+	{"сен", time.September}, {"окт", time.October}, {"ноя", time.November},
+	{"дек", time.December},
+	{"jan", time.January}, {"feb", time.February}, {"mar", time.March},
+	{"apr", time.April}, {"may", time.May}, {"jun", time.June},
+	{"jul", time.July}, {"aug", time.August}, {"sep", time.September},
+	{"oct", time.October}, {"nov", time.November}, {"dec", time.December},
+}
+
+var relativeDays = map[string]int{
+	"сегодня":     0,
+	"завтра":      1,
+	"послезавтра": 2,
+	"today":       0,
+	"tomorrow":    1,
+}
+
+// rangeWords separate the sides of a range like a dash: "с 1 по 5 июля", "from Oct 1 to Oct 5"
+var rangeWords = map[string]bool{
+	"по":      true,
+	"до":      true,
+	"to":      true,
+	"until":   true,
+	"till":    true,
+	"through": true,
+}
+
+// dateParts is one side of a date range. Zero values mean "not specified".
+type dateParts struct {
+	day    int
+	month  time.Month
+	year   int
+	offset int
+	hasDay bool
+	rel    bool
+}
+
+// Parse parses raw into an EventDate. Supported forms include "15 октября, 19:00",
+// "пт, 3 ноя", "12–14 июля", "с 1 сентября по 30 ноября", "сегодня в 20:00", "October 15, 2024", "15.10.2024"
+// and ISO 8601 timestamps and intervals such as "2024-10-15T19:00/2024-10-17".
+func (p *Parser) Parse(raw string) (EventDate, error) {
+	result := EventDate{Raw: raw}
+	text := strings.TrimSpace(raw)
+	if text == "" {
+		return result, fmt.Errorf("empty date")
+	}
+
+	if start, hasTime, ok := p.parseISO(text); ok {
+		result.Start, result.End, result.HasTime = start, start, hasTime
+		return result, nil
+	}
+	if startText, endText, ok := strings.Cut(text, "/"); ok {
+		start, hasTime, startOK := p.parseISO(startText)
+		end, _, endOK := p.parseISO(endText)
+		if startOK && endOK {
+			if end.Before(start) {
+				end = start
+			}
+			result.Start, result.End, result.HasTime = start, end, hasTime
+			return result, nil
+		}
+	}
+
+	text = strings.ToLower(text)
+
+	// Times are taken out first so that "19:00" is not mistaken for a day
+	var clock [][2]int
+	for _, m := range timePattern.FindAllStringSubmatch(text, -1) {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour < 24 && minute < 60 {
+			clock = append(clock, [2]int{hour, minute})
+		}
+	}
+	text = timePattern.ReplaceAllString(text, " ")
+
+	// Numeric dates become "day #month year" so they share the token logic below
+	text = numericPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := numericPattern.FindStringSubmatch(s)
+		return strings.TrimSpace(fmt.Sprintf("%s #%s %s", m[1], m[2], m[3]))
+	})
+	text = dashPattern.ReplaceAllString(text, " - ")
+	text = cleanPattern.ReplaceAllString(text, " ")
+
+	var sides []dateParts
+	current := dateParts{}
+	for _, token := range strings.Fields(text) {
+		if token == "-" || rangeWords[token] {
+			sides = append(sides, current)
+			current = dateParts{}
+			continue
+		}
+		parseToken(token, &current)
+	}
+	sides = append(sides, current)
+	// "до 30 ноября" has nothing before the range word
+	if first := sides[0]; len(sides) > 1 && !first.hasDay && first.month == 0 && !first.rel {
+		sides = sides[1:]
+	}
+
+	start := sides[0]
+	end := sides[len(sides)-1]
+	if len(sides) > 1 {
+		// "12–14 июля": the left side borrows month and year from the right.
+		// "July 12–14": the right side borrows the month from the left.
+		if start.month == 0 {
+			start.month = end.month
+		}
+		if start.year == 0 {
+			start.year = end.year
+		}
+		if end.month == 0 {
+			end.month = start.month
+		}
+		if !end.hasDay && !end.rel {
+			end = start
+		}
+	}
+
+	// A range without years takes its year from the end, so that a range that
+	// has already started stays in this year: "1 сентября – 30 ноября" in October
+	if len(sides) > 1 && start.year == 0 && end.year == 0 && !start.rel && !end.rel {
+		if endTime, err := p.resolve(end); err == nil {
+			start.year = endTime.Year()
+			if start.month > end.month || (start.month == end.month && start.day > end.day) {
+				start.year--
+			}
+		}
+	}
+
+	startTime, err := p.resolve(start)
+	if err != nil {
+		return result, fmt.Errorf("unrecognized date %q: %v", raw, err)
+	}
+	endTime, err := p.resolve(end)
+	if err != nil {
+		endTime = startTime
+	}
+
+	if len(clock) > 0 {
+		startTime = withClock(startTime, clock[0])
+		endTime = withClock(endTime, clock[len(clock)-1])
+		result.HasTime = true
+	}
+
+	// A range without explicit years may cross New Year
+	for endTime.Before(startTime) && end.year == 0 && !end.rel && len(sides) > 1 {
+		endTime = endTime.AddDate(1, 0, 0)
+	}
+	if endTime.Before(startTime) {
+		endTime = startTime
+	}
+
+	result.Start, result.End = startTime, endTime
+	return result, nil
+}
+
+// parseISO parses an ISO 8601 timestamp and reports whether it has a time of day.
+func (p *Parser) parseISO(text string) (time.Time, bool, bool) {
+	for _, layout := range isoLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(text), p.Location); err == nil {
+			return t.In(p.Location), layout != "2006-01-02", true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// Parse parses raw with a Parser for the given location.
+func Parse(raw string, location *time.Location) (EventDate, error) {
+	return NewParser(location).Parse(raw)
+}
+
+// parseToken records the meaning of a single token in parts. Unknown words
+// such as weekdays and prepositions are ignored.
+func parseToken(token string, parts *dateParts) {
+	if offset, ok := relativeDays[token]; ok {
+		parts.rel = true
+		parts.offset = offset
+		return
+	}
+
+	if strings.HasPrefix(token, "#") {
+		if month, err := strconv.Atoi(token[1:]); err == nil && month >= 1 && month <= 12 {
+			parts.month = time.Month(month)
+		}
+		return
+	}
+
+	if number, err := strconv.Atoi(token); err == nil {
+		switch {
+		case len(token) == 4 && number >= 1900:
+			parts.year = number
+		case len(token) == 2 && parts.hasDay && parts.month != 0 && parts.year == 0:
+			parts.year = 2000 + number
+		case number >= 1 && number <= 31 && !parts.hasDay:
+			parts.day = number
+			parts.hasDay = true
+		}
+		return
+	}
+
+	// "15th" and similar suffixes
+	if i := strings.IndexFunc(token, func(r rune) bool { return r < '0' || r > '9' }); i > 0 {
+		if number, err := strconv.Atoi(token[:i]); err == nil && number >= 1 && number <= 31 && !parts.hasDay {
+			parts.day = number
+			parts.hasDay = true
+			return
+		}
+	}
+
+	for _, candidate := range monthPrefixes {
+		if strings.HasPrefix(token, candidate.prefix) {
+			parts.month = candidate.month
+			return
+		}
+	}
+}
+
+// resolve turns date parts into a time at midnight, inferring a missing year.
+func (p *Parser) resolve(parts dateParts) (time.Time, error) {
+	now := p.Now().In(p.Location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, p.Location)
+
+	if parts.rel {
+		return today.AddDate(0, 0, parts.offset), nil
+	}
+	if !parts.hasDay || parts.month == 0 {
+		return time.Time{}, fmt.Errorf("day or month missing")
+	}
+
+	year := parts.year
+	if year == 0 {
+		year = now.Year()
+		candidate := time.Date(year, parts.month, parts.day, 0, 0, 0, 0, p.Location)
+		if candidate.Before(today.Add(-pastTolerance)) {
+			year++
+		}
+	}
+
+	t := time.Date(year, parts.month, parts.day, 0, 0, 0, 0, p.Location)
+	if t.Day() != parts.day {
+		return time.Time{}, fmt.Errorf("day %d out of range for %s", parts.day, parts.month)
+	}
+	return t, nil
+}
+
+func withClock(t time.Time, clock [2]int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), clock[0], clock[1], 0, 0, t.Location())
+}
@@ -0,0 +1,106 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParserParse(t *testing.T) {
+	location := time.FixedZone("MSK", 3*60*60)
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, location)
+	}
+	october := date(2024, time.October, 10, 12, 0)
+	december := date(2024, time.December, 20, 12, 0)
+	autumn := date(2026, time.October, 18, 12, 0)
+
+	tests := []struct {
+		name    string
+		raw     string
+		now     time.Time
+		start   time.Time
+		end     time.Time
+		hasTime bool
+	}{
+		{"russian month with time", "15 октября, 19:00", october, date(2024, time.October, 15, 19, 0), date(2024, time.October, 15, 19, 0), true},
+		{"weekday and short month", "пт, 3 ноя", october, date(2024, time.November, 3, 0, 0), date(2024, time.November, 3, 0, 0), false},
+		{"nominative month", "1 май 2025", october, date(2025, time.May, 1, 0, 0), date(2025, time.May, 1, 0, 0), false},
+		{"english month first", "October 15, 2024", october, date(2024, time.October, 15, 0, 0), date(2024, time.October, 15, 0, 0), false},
+		{"english ordinal", "15th Nov", october, date(2024, time.November, 15, 0, 0), date(2024, time.November, 15, 0, 0), false},
+		{"numeric", "15.10.2024", october, date(2024, time.October, 15, 0, 0), date(2024, time.October, 15, 0, 0), false},
+		{"numeric short year", "15.10.24 18:30", october, date(2024, time.October, 15, 18, 30), date(2024, time.October, 15, 18, 30), true},
+		{"numeric without year", "20.10", october, date(2024, time.October, 20, 0, 0), date(2024, time.October, 20, 0, 0), false},
+
+		{"range with shared month", "12–14 июля 2025", october, date(2025, time.July, 12, 0, 0), date(2025, time.July, 14, 0, 0), false},
+		{"range with month first", "Nov 12 - 14", october, date(2024, time.November, 12, 0, 0), date(2024, time.November, 14, 0, 0), false},
+		{"range across months", "30 октября — 2 ноября", october, date(2024, time.October, 30, 0, 0), date(2024, time.November, 2, 0, 0), false},
+		{"time range", "15 октября 19:00–21:00", october, date(2024, time.October, 15, 19, 0), date(2024, time.October, 15, 21, 0), true},
+
+		{"today with time", "сегодня в 20:00", october, date(2024, time.October, 10, 20, 0), date(2024, time.October, 10, 20, 0), true},
+		{"tomorrow", "завтра", october, date(2024, time.October, 11, 0, 0), date(2024, time.October, 11, 0, 0), false},
+		{"day after tomorrow", "послезавтра", october, date(2024, time.October, 12, 0, 0), date(2024, time.October, 12, 0, 0), false},
+		{"english today", "Today 18:00", october, date(2024, time.October, 10, 18, 0), date(2024, time.October, 10, 18, 0), true},
+
+		{"recent past stays in this year", "15 сентября", october, date(2024, time.September, 15, 0, 0), date(2024, time.September, 15, 0, 0), false},
+		{"distant past moves to next year", "1 сентября", october, date(2025, time.September, 1, 0, 0), date(2025, time.September, 1, 0, 0), false},
+		{"january seen in december", "10 января", december, date(2025, time.January, 10, 0, 0), date(2025, time.January, 10, 0, 0), false},
+		{"range across new year", "28 декабря – 3 января", december, date(2024, time.December, 28, 0, 0), date(2025, time.January, 3, 0, 0), false},
+		{"range across new year seen in october", "28 декабря – 3 января", october, date(2024, time.December, 28, 0, 0), date(2025, time.January, 3, 0, 0), false},
+		{"range that has already started", "1 сентября – 30 ноября", autumn, date(2026, time.September, 1, 0, 0), date(2026, time.November, 30, 0, 0), false},
+		{"english range that has already started", "1 September – 30 November", autumn, date(2026, time.September, 1, 0, 0), date(2026, time.November, 30, 0, 0), false},
+		{"started range across new year", "1 декабря – 31 января", date(2025, time.January, 10, 12, 0), date(2024, time.December, 1, 0, 0), date(2025, time.January, 31, 0, 0), false},
+		{"range that ended long ago moves to next year", "1 – 5 июля", october, date(2025, time.July, 1, 0, 0), date(2025, time.July, 5, 0, 0), false},
+
+		{"range with words", "с 1 сентября по 30 ноября", autumn, date(2026, time.September, 1, 0, 0), date(2026, time.November, 30, 0, 0), false},
+		{"english range with words", "from Oct 1 to Oct 5", october, date(2024, time.October, 1, 0, 0), date(2024, time.October, 5, 0, 0), false},
+		{"until a date", "до 30 ноября", october, date(2024, time.November, 30, 0, 0), date(2024, time.November, 30, 0, 0), false},
+		{"time range with words", "15 октября с 19:00 до 21:00", october, date(2024, time.October, 15, 19, 0), date(2024, time.October, 15, 21, 0), true},
+
+		{"iso timestamp", "2024-10-15T19:00:00+03:00", october, date(2024, time.October, 15, 19, 0), date(2024, time.October, 15, 19, 0), true},
+		{"iso timestamp in utc", "2024-10-15T16:00:00Z", october, date(2024, time.October, 15, 19, 0), date(2024, time.October, 15, 19, 0), true},
+		{"iso date", "2024-10-15", october, date(2024, time.October, 15, 0, 0), date(2024, time.October, 15, 0, 0), false},
+		{"iso interval", "2024-10-15T19:00/2024-10-17", october, date(2024, time.October, 15, 19, 0), date(2024, time.October, 17, 0, 0), true},
+		{"iso interval of dates", "2024-12-28/2025-01-03", october, date(2024, time.December, 28, 0, 0), date(2025, time.January, 3, 0, 0), false},
+		{"iso interval ending before start", "2024-10-17/2024-10-15", october, date(2024, time.October, 17, 0, 0), date(2024, time.October, 17, 0, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			parser := &Parser{Location: location, Now: func() time.Time { return now }}
+
+			got, err := parser.Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.raw, err)
+			}
+			if !got.Start.Equal(tt.start) || !got.End.Equal(tt.end) {
+				t.Errorf("Parse(%q) = %v – %v, want %v – %v", tt.raw, got.Start, got.End, tt.start, tt.end)
+			}
+			if got.HasTime != tt.hasTime {
+				t.Errorf("Parse(%q).HasTime = %v, want %v", tt.raw, got.HasTime, tt.hasTime)
+			}
+			if got.Raw != tt.raw {
+				t.Errorf("Parse(%q).Raw = %q", tt.raw, got.Raw)
+			}
+		})
+	}
+}
+
+func TestParserParseErrors(t *testing.T) {
+	now := time.Date(2024, time.October, 10, 12, 0, 0, 0, time.UTC)
+	parser := &Parser{Location: time.UTC, Now: func() time.Time { return now }}
+
+	for _, raw := range []string{
+		"",
+		"   ",
+		"скоро",
+		"октябрь",
+		"31 февраля",
+		"31.02.2024",
+		"2024-10-15/later",
+	} {
+		if got, err := parser.Parse(raw); err == nil {
+			t.Errorf("Parse(%q) = %v – %v, want an error", raw, got.Start, got.End)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package drift detects sites whose selectors stopped matching after a markup change
+// by comparing the latest run with the run history.
+package drift
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/storage"
+)
+
+const (
+	defaultWindow    = 5
+	defaultMinRuns   = 3
+	defaultCountDrop = 0.5
+	defaultFillDrop  = 0.5
+
+	// minBaselineEvents keeps sites that rarely have events from raising alerts
+	minBaselineEvents = 3
+	// minBaselineFill ignores fields that are usually empty anyway
+	minBaselineFill = 0.5
+	// historyScanLimit bounds how many recent runs are read to build the baseline
+	historyScanLimit = 200
+)
+
+// Alert kinds
+const (
+	KindEventCount = "event_count"
+	KindFillRate   = "fill_rate"
+)
+
+// SourceStructured is the Alert.Selector of sites whose events come from
+// structured data alone, where no selector is to blame.
+const SourceStructured = "Structured"
+
+// Alert names a site and the selector that most likely broke.
+type Alert struct {
+	URL       string
+	EventType string
+	Kind      string
+	// Selector is the SiteConfig field to check, SourceStructured for structured data
+	Selector string
+	// Current and Baseline are event counts or fill rates between 0 and 1, depending on Kind
+	Current  float64
+	Baseline float64
+	// Runs is the number of previous runs the baseline was built from
+	Runs int
+}
+
+func (a Alert) String() string {
+	if a.Kind == KindEventCount && a.Selector == SourceStructured {
+		return fmt.Sprintf("%s (%s): %.0f events against %.1f on average over %d runs, check the structured data (JSON-LD or microdata) of the page",
+			a.URL, a.EventType, a.Current, a.Baseline, a.Runs)
+	}
+	if a.Kind == KindEventCount {
+		return fmt.Sprintf("%s (%s): %.0f events against %.1f on average over %d runs, check %s",
+			a.URL, a.EventType, a.Current, a.Baseline, a.Runs, a.Selector)
+	}
+	return fmt.Sprintf("%s (%s): %s filled for %.0f%% of events against %.0f%% on average over %d runs",
+		a.URL, a.EventType, a.Selector, a.Current*100, a.Baseline*100, a.Runs)
+}
+
+// Detector compares runs with the history kept in a store.
+type Detector struct {
+	store     *storage.Store
+	window    int
+	minRuns   int
+	countDrop float64
+	fillDrop  float64
+}
+
+// NewDetector creates a Detector, applying defaults to zero settings.
+func NewDetector(store *storage.Store, cfg appconfig.DriftConfig) *Detector {
+	d := &Detector{
+		store:     store,
+		window:    cfg.Window,
+		minRuns:   cfg.MinRuns,
+		countDrop: cfg.CountDrop,
+		fillDrop:  cfg.FillDrop,
+	}
+	if d.window <= 0 {
+		d.window = defaultWindow
+	}
+	if d.minRuns <= 0 {
+		d.minRuns = defaultMinRuns
+	}
+	if d.minRuns > d.window {
+		d.window = d.minRuns
+	}
+	if d.countDrop == 0 {
+		d.countDrop = defaultCountDrop
+	}
+	if d.fillDrop == 0 {
+		d.fillDrop = defaultFillDrop
+	}
+	return d
+}
+
+// Check compares every site of a recorded run with its previous runs.
+// Failed sites are skipped, they are already reported by the run report.
+// A site that stays broken is only reported on the run where it broke.
+func (d *Detector) Check(run storage.Run) ([]Alert, error) {
+	runs, err := d.store.Runs(historyScanLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error loading run history: %v", err)
+	}
+
+	var alerts []Alert
+	for _, report := range run.Reports {
+		if !usable(report) {
+			continue
+		}
+		history := d.siteHistory(runs, run.ID, report)
+		if len(history) < d.minRuns {
+			continue
+		}
+		alerts = append(alerts, d.checkSite(report, history)...)
+	}
+	return alerts, nil
+}
+
+// siteHistory returns the reports of the same site from runs before runID, newest first.
+// One extra report beyond the window is kept to tell whether the previous run was already off.
+func (d *Detector) siteHistory(runs []storage.Run, runID uint64, current appconfig.SiteReport) []appconfig.SiteReport {
+	var history []appconfig.SiteReport
+	for _, run := range runs {
+		if run.ID >= runID {
+			continue
+		}
+		for _, report := range run.Reports {
+			if sameSite(report, current) && usable(report) {
+				history = append(history, report)
+				break
+			}
+		}
+		if len(history) > d.window {
+			break
+		}
+	}
+	return history
+}
+
+// checkSite compares a site's latest report with its history.
+func (d *Detector) checkSite(current appconfig.SiteReport, history []appconfig.SiteReport) []Alert {
+	var alerts []Alert
+	newAlert := func(kind, selector string, value float64, baseline float64, runs int) Alert {
+		return Alert{
+			URL:       current.URL,
+			EventType: current.EventType,
+			Kind:      kind,
+			Selector:  selector,
+			Current:   value,
+			Baseline:  baseline,
+			Runs:      runs,
+		}
+	}
+
+	// Sites crawled without selectors take every field from the page's structured data
+	structuredOnly := current.Structured == appconfig.StructuredOnly
+
+	events := func(r appconfig.SiteReport) float64 { return float64(r.Events) }
+	if value, baseline, runs, ok := d.dropped(current, history, events, minBaselineEvents, d.countDrop); ok {
+		source := "AnchestorSelector"
+		if structuredOnly {
+			source = SourceStructured
+		}
+		alerts = append(alerts, newAlert(KindEventCount, source, value, baseline, runs))
+		// With most events gone fill rates say little about the other selectors
+		return alerts
+	}
+	// Fill rates point at selectors, which these sites don't have
+	if structuredOnly {
+		return alerts
+	}
+
+	fields := []struct {
+		selector string
+		rate     func(appconfig.SiteReport) float64
+	}{
+		{"TitleSelector", func(r appconfig.SiteReport) float64 { return ratio(r.Filled.Title, r.Events+r.Rejected) }},
+		{"DateSelector", func(r appconfig.SiteReport) float64 { return ratio(r.Filled.Date, r.Events) }},
+		{"LinkSelector", func(r appconfig.SiteReport) float64 { return ratio(r.Filled.Link, r.Events) }},
+	}
+	// Fill rates only make sense for runs that found something
+	if current.Events+current.Rejected == 0 {
+		return alerts
+	}
+	var withEvents []appconfig.SiteReport
+	for _, report := range history {
+		if report.Events+report.Rejected > 0 {
+			withEvents = append(withEvents, report)
+		}
+	}
+	if len(withEvents) < d.minRuns {
+		return alerts
+	}
+
+	for _, field := range fields {
+		if value, baseline, runs, ok := d.dropped(current, withEvents, field.rate, minBaselineFill, d.fillDrop); ok {
+			alerts = append(alerts, newAlert(KindFillRate, field.selector, value, baseline, runs))
+		}
+	}
+	return alerts
+}
+
+// dropped reports whether metric of current fell below its average over the history
+// by more than drop, while the previous run was still fine.
+func (d *Detector) dropped(current appconfig.SiteReport, history []appconfig.SiteReport, metric func(appconfig.SiteReport) float64, minBaseline, drop float64) (float64, float64, int, bool) {
+	baselineRuns := history
+	if len(baselineRuns) > d.window {
+		baselineRuns = baselineRuns[:d.window]
+	}
+	baseline := average(baselineRuns, metric)
+	value := metric(current)
+	if baseline < minBaseline || value >= baseline*(1-drop) {
+		return value, baseline, len(baselineRuns), false
+	}
+
+	// The previous run compared with the runs before it: if it was already off, it has been reported
+	if len(history) > d.minRuns {
+		previous := history[1:]
+		if len(previous) > d.window {
+			previous = previous[:d.window]
+		}
+		if previousBaseline := average(previous, metric); previousBaseline >= minBaseline && metric(history[0]) < previousBaseline*(1-drop) {
+			return value, baseline, len(baselineRuns), false
+		}
+	}
+
+	return value, baseline, len(baselineRuns), true
+}
+
+// usable reports whether a site report reflects what the selectors found.
+func usable(report appconfig.SiteReport) bool {
+	return report.Status == appconfig.SiteOK || report.Status == appconfig.SiteEmpty
+}
+
+// sameSite matches reports of the same site configuration across runs.
+func sameSite(a, b appconfig.SiteReport) bool {
+	return strings.TrimRight(a.URL, "/") == strings.TrimRight(b.URL, "/") && a.EventType == b.EventType
+}
+
+func average(reports []appconfig.SiteReport, metric func(appconfig.SiteReport) float64) float64 {
+	if len(reports) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, report := range reports {
+		sum += metric(report)
+	}
+	return sum / float64(len(reports))
+}
+
+func ratio(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
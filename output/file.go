@@ -0,0 +1,163 @@
+package output
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/storage"
+)
+
+var csvHeader = []string{"run_id", "title", "date", "start", "end", "location", "price", "description", "link", "event_type", "source"}
+
+// CSVSink appends events to a CSV file, writing the header when the file is new.
+type CSVSink struct {
+	path string
+}
+
+// NewCSVSink creates a CSVSink writing to path.
+func NewCSVSink(path string) *CSVSink {
+	return &CSVSink{path: path}
+}
+
+func (s *CSVSink) Name() string {
+	return appconfig.SinkCSV
+}
+
+func (s *CSVSink) Write(ctx context.Context, run storage.Run, events []appconfig.EventConfig) error {
+	file, isNew, err := openForAppend(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if isNew {
+		if err := writer.Write(csvHeader); err != nil {
+			return fmt.Errorf("error writing CSV header: %v", err)
+		}
+	}
+
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record := []string{
+			strconv.FormatUint(run.ID, 10),
+			event.Title,
+			event.Date,
+			formatTime(event.Start),
+			formatTime(event.End),
+			event.Location,
+			event.Price,
+			event.Description,
+			event.Link,
+			event.EventType,
+			event.Source,
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("error writing CSV record: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing CSV file %s: %v", s.path, err)
+	}
+	return file.Close()
+}
+
+// JSONLinesSink appends one JSON object per event to a file.
+type JSONLinesSink struct {
+	path string
+}
+
+// NewJSONLinesSink creates a JSONLinesSink writing to path.
+func NewJSONLinesSink(path string) *JSONLinesSink {
+	return &JSONLinesSink{path: path}
+}
+
+func (s *JSONLinesSink) Name() string {
+	return appconfig.SinkJSONLines
+}
+
+func (s *JSONLinesSink) Write(ctx context.Context, run storage.Run, events []appconfig.EventConfig) error {
+	file, _, err := openForAppend(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := struct {
+			RunID uint64 `json:"run_id"`
+			appconfig.EventConfig
+		}{RunID: run.ID, EventConfig: event}
+		if err := encoder.Encode(line); err != nil {
+			return fmt.Errorf("error writing JSON line to %s: %v", s.path, err)
+		}
+	}
+
+	return file.Close()
+}
+
+// BoltSink records the run in a separate bbolt database, e.g. for export to other tools.
+type BoltSink struct {
+	path string
+}
+
+// NewBoltSink creates a BoltSink writing to the database at path.
+func NewBoltSink(path string) *BoltSink {
+	return &BoltSink{path: path}
+}
+
+func (s *BoltSink) Name() string {
+	return appconfig.SinkBolt
+}
+
+func (s *BoltSink) Write(ctx context.Context, run storage.Run, events []appconfig.EventConfig) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store, err := storage.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	_, err = store.RecordRun(run, events)
+	return err
+}
+
+// openForAppend opens path for appending and reports whether the file was empty.
+func openForAppend(path string) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, false, fmt.Errorf("error opening %s: %v", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, false, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	return file, info.Size() == 0, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,30 @@
+package output
+
+import (
+	"context"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/spreadsheets"
+	"github.com/rx3lixir/crawler/storage"
+)
+
+// SheetsSink writes events to the configured Google Sheets spreadsheet.
+type SheetsSink struct {
+	config appconfig.AppConfig
+}
+
+// NewSheetsSink creates a SheetsSink using the credentials from the application config.
+func NewSheetsSink(crawlerAppConfig appconfig.AppConfig) *SheetsSink {
+	return &SheetsSink{config: crawlerAppConfig}
+}
+
+func (s *SheetsSink) Name() string {
+	return appconfig.SinkSheets
+}
+
+func (s *SheetsSink) Write(ctx context.Context, run storage.Run, events []appconfig.EventConfig) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return spreadsheets.WriteToSpreadsheet(ctx, events, s.config)
+}
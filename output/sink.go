@@ -0,0 +1,74 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/storage"
+)
+
+// Sink receives the events found by a run.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, run storage.Run, events []appconfig.EventConfig) error
+}
+
+// NewSinks creates the sinks listed in the application config.
+// Without any configured sinks events go to Google Sheets.
+func NewSinks(crawlerAppConfig appconfig.AppConfig) ([]Sink, error) {
+	sinkConfigs := crawlerAppConfig.Sinks
+	if len(sinkConfigs) == 0 {
+		sinkConfigs = []appconfig.SinkConfig{{Type: appconfig.SinkSheets}}
+	}
+
+	var sinks []Sink
+	for _, sinkConfig := range sinkConfigs {
+		sink, err := newSink(sinkConfig, crawlerAppConfig)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+func newSink(sinkConfig appconfig.SinkConfig, crawlerAppConfig appconfig.AppConfig) (Sink, error) {
+	if sinkConfig.Type != appconfig.SinkSheets && sinkConfig.Path == "" {
+		return nil, fmt.Errorf("sink %q requires a path", sinkConfig.Type)
+	}
+
+	switch sinkConfig.Type {
+	case appconfig.SinkSheets:
+		return NewSheetsSink(crawlerAppConfig), nil
+	case appconfig.SinkCSV:
+		return NewCSVSink(sinkConfig.Path), nil
+	case appconfig.SinkJSONLines:
+		return NewJSONLinesSink(sinkConfig.Path), nil
+	case appconfig.SinkBolt:
+		if sinkConfig.Path == crawlerAppConfig.StorePath {
+			return nil, fmt.Errorf("sink %q can't use the history store %s", sinkConfig.Type, sinkConfig.Path)
+		}
+		return NewBoltSink(sinkConfig.Path), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sinkConfig.Type)
+	}
+}
+
+// WriteAll writes events to every sink. A failing sink doesn't stop the others;
+// all failures are returned together.
+func WriteAll(ctx context.Context, sinks []Sink, run storage.Run, events []appconfig.EventConfig) error {
+	var errs []string
+	for _, sink := range sinks {
+		if err := sink.Write(ctx, run, events); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", sink.Name(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("errors writing results: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/drift"
+	"github.com/rx3lixir/crawler/output"
+	"github.com/rx3lixir/crawler/storage"
+	"github.com/rx3lixir/crawler/web"
+)
+
+// Request describes a single crawl.
+type Request struct {
+	Sites []appconfig.SiteConfig
+	// ChatID is the Telegram chat that owns the run, 0 outside the bot
+	ChatID int64
+	// Store records the run history, may be nil
+	Store   *storage.Store
+	Sinks   []output.Sink
+	Options web.Options
+	// Drift tunes selector drift detection, which needs Store
+	Drift appconfig.DriftConfig
+}
+
+// Result is the outcome of a crawl. The per-site reports are in Run.Reports.
+type Result struct {
+	Run    storage.Run
+	Events []appconfig.EventConfig
+	// WriteErr holds the errors of sinks that failed; the run is recorded regardless
+	WriteErr error
+	// Alerts lists sites whose results dropped compared with their history
+	Alerts []drift.Alert
+}
+
+// Execute scrapes the sites, records the run and writes the events to every sink.
+// If ctx is cancelled during scraping nothing is recorded or written and ctx.Err() is returned.
+func Execute(ctx context.Context, req Request) (Result, error) {
+	startedAt := time.Now()
+	events, reports := web.WebScraper(ctx, req.Sites, req.Options)
+	if err := ctx.Err(); err != nil {
+		return Result{Events: events}, err
+	}
+
+	run := storage.Run{ChatID: req.ChatID, StartedAt: startedAt, FinishedAt: time.Now(), Reports: reports}
+	for _, config := range req.Sites {
+		run.Sites = append(run.Sites, config.UrlToVisit)
+	}
+
+	// Record the run in the history
+	if req.Store != nil {
+		if recorded, err := req.Store.RecordRun(run, events); err != nil {
+			log.Printf("Error saving run: %v", err)
+		} else {
+			run = recorded
+		}
+	}
+
+	result := Result{Run: run, Events: events}
+	result.WriteErr = output.WriteAll(ctx, req.Sinks, run, events)
+
+	// Look for sites whose selectors may have stopped matching
+	if run.ID != 0 && !req.Drift.Disabled {
+		alerts, err := drift.NewDetector(req.Store, req.Drift).Check(run)
+		if err != nil {
+			log.Printf("Error checking selector drift: %v", err)
+		}
+		result.Alerts = alerts
+	}
+
+	return result, nil
+}
@@ -0,0 +1,183 @@
+// Package retry repeats failed outbound calls with exponential backoff and jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = time.Second
+	defaultMaxDelay    = 30 * time.Second
+	defaultJitter      = 0.2
+)
+
+// Policy describes how a call is retried.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// BaseDelay is the pause after the first failure, doubled after each next one
+	BaseDelay time.Duration
+	// MaxDelay caps the pause. A Retry-After longer than that stops retrying
+	MaxDelay time.Duration
+	// Jitter is the random fraction added to or removed from each pause, from 0 to 1
+	Jitter float64
+	// Retryable decides whether an error is worth another attempt, IsRetryable if nil
+	Retryable func(error) bool
+	// OnRetry, if set, is called before each pause
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// New creates a Policy from the configuration, applying defaults to zero values.
+func New(cfg appconfig.RetryConfig) Policy {
+	p := Policy{
+		MaxAttempts: cfg.MaxAttempts,
+		BaseDelay:   time.Duration(cfg.BaseDelayMs) * time.Millisecond,
+		MaxDelay:    time.Duration(cfg.MaxDelayMs) * time.Millisecond,
+		Jitter:      cfg.Jitter,
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultMaxDelay
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	if p.Jitter == 0 {
+		p.Jitter = defaultJitter
+	}
+	return p
+}
+
+// Do calls fn until it succeeds, returns an error that isn't retryable, the attempts
+// run out or ctx is done. The last error of fn is returned unchanged.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		delay, ok := p.delay(attempt, err)
+		if !ok {
+			return err
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// delay returns the pause after a failed attempt, or false if the server asked
+// to wait longer than MaxDelay.
+func (p Policy) delay(attempt int, err error) (time.Duration, bool) {
+	backoff := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if backoff > float64(p.MaxDelay) {
+		backoff = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	delay := time.Duration(backoff)
+
+	var after interface{ RetryAfter() time.Duration }
+	if errors.As(err, &after) {
+		if wait := after.RetryAfter(); wait > p.MaxDelay {
+			return 0, false
+		} else if wait > delay {
+			delay = wait
+		}
+	}
+	return delay, true
+}
+
+// IsRetryable is the default classification: errors that say whether they are
+// retryable decide for themselves, timeouts and dropped or refused connections
+// are retried. Cancellation and other errors, including permanent request failures
+// like a bad URL scheme or an invalid certificate, are not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var classified interface{ Retryable() bool }
+	if errors.As(err, &classified) {
+		return classified.Retryable()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsTemporary {
+		return true
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError reports whether a connection was refused or dropped,
+// which usually passes when the server is back.
+func isConnectionError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// RetryableStatus reports whether an HTTP status code is worth retrying:
+// rate limiting and server errors are, other client errors are not.
+func RetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// ParseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+// It returns zero if the header is missing or invalid.
+func ParseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
@@ -0,0 +1,253 @@
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+// throttledError asks to wait before the next attempt, like a 429 with Retry-After.
+type throttledError struct{ after time.Duration }
+
+func (e throttledError) Error() string             { return "throttled" }
+func (e throttledError) RetryAfter() time.Duration { return e.after }
+
+// classifiedError decides for itself whether it is retryable.
+type classifiedError struct{ retryable bool }
+
+func (e classifiedError) Error() string   { return "classified" }
+func (e classifiedError) Retryable() bool { return e.retryable }
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	plain := errors.New("failed")
+
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		want    time.Duration
+		ok      bool
+	}{
+		{"first failure", 1, plain, time.Second, true},
+		{"doubles", 2, plain, 2 * time.Second, true},
+		{"doubles again", 4, plain, 8 * time.Second, true},
+		{"capped", 5, plain, 10 * time.Second, true},
+		{"capped far out", 40, plain, 10 * time.Second, true},
+		{"retry-after longer than backoff", 1, throttledError{5 * time.Second}, 5 * time.Second, true},
+		{"retry-after shorter than backoff", 3, throttledError{time.Second}, 4 * time.Second, true},
+		{"retry-after equal to max delay", 1, throttledError{10 * time.Second}, 10 * time.Second, true},
+		{"retry-after beyond max delay", 1, throttledError{11 * time.Second}, 0, false},
+		{"wrapped retry-after", 1, fmt.Errorf("page: %w", throttledError{3 * time.Second}), 3 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := policy.delay(tt.attempt, tt.err)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("delay(%d, %v) = %v, %v, want %v, %v", tt.attempt, tt.err, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPolicyDelayJitter(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Jitter: 0.2}
+
+	for _, tt := range []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 800 * time.Millisecond, 1200 * time.Millisecond},
+		{3, 3200 * time.Millisecond, 4800 * time.Millisecond},
+		{10, 8 * time.Second, 12 * time.Second},
+	} {
+		for i := 0; i < 100; i++ {
+			got, ok := policy.delay(tt.attempt, errors.New("failed"))
+			if !ok || got < tt.min || got > tt.max {
+				t.Fatalf("delay(%d) = %v, %v, want between %v and %v", tt.attempt, got, ok, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  appconfig.RetryConfig
+		want Policy
+	}{
+		{"zero values", appconfig.RetryConfig{}, Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Jitter: 0.2}},
+		{"explicit", appconfig.RetryConfig{MaxAttempts: 5, BaseDelayMs: 200, MaxDelayMs: 2000, Jitter: 0.5}, Policy{MaxAttempts: 5, BaseDelay: 200 * time.Millisecond, MaxDelay: 2 * time.Second, Jitter: 0.5}},
+		{"max delay below base", appconfig.RetryConfig{BaseDelayMs: 5000, MaxDelayMs: 1000}, Policy{MaxAttempts: 3, BaseDelay: 5 * time.Second, MaxDelay: 5 * time.Second, Jitter: 0.2}},
+		{"negative jitter disables it", appconfig.RetryConfig{Jitter: -1}, Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second, Jitter: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.cfg)
+			if got.MaxAttempts != tt.want.MaxAttempts || got.BaseDelay != tt.want.BaseDelay || got.MaxDelay != tt.want.MaxDelay || got.Jitter != tt.want.Jitter {
+				t.Errorf("New(%+v) = %+v, want %+v", tt.cfg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	fast := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	transient := classifiedError{retryable: true}
+	permanent := classifiedError{retryable: false}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		want     error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"success after retries", []error{transient, transient, nil}, 3, nil},
+		{"attempts run out", []error{transient, transient, transient, nil}, 3, transient},
+		{"not retryable", []error{permanent, nil}, 1, permanent},
+		{"cancellation", []error{context.Canceled, nil}, 1, context.Canceled},
+		{"retry-after too long", []error{throttledError{time.Hour}, nil}, 1, throttledError{time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := fast
+			// throttledError has no Retryable method of its own
+			policy.Retryable = func(err error) bool { return IsRetryable(err) || errors.As(err, new(throttledError)) }
+
+			attempts := 0
+			err := policy.Do(context.Background(), func() error {
+				err := tt.errs[attempts]
+				attempts++
+				return err
+			})
+			if err != tt.want {
+				t.Errorf("Do() = %v, want %v", err, tt.want)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("Do() made %d attempts, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestPolicyDoStopsWhenContextIsDone(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	failure := classifiedError{retryable: true}
+	err := policy.Do(ctx, func() error {
+		attempts++
+		return failure
+	})
+	if err != failure || attempts != 1 {
+		t.Errorf("Do() = %v after %d attempts, want the last error after 1 attempt", err, attempts)
+	}
+}
+
+// timeoutError is a network timeout, like the one of an http.Client.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	// Requests that fail before anything is sent return the real *url.Error
+	_, schemeErr := http.Get("ftp://example.com/events")
+	_, malformedErr := http.Get("http://example.com/%zz")
+	requestErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com/events", Err: err}
+	}
+	dialErr := func(errno syscall.Errno) error {
+		return requestErr(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", context.Canceled, false},
+		{"wrapped cancellation", fmt.Errorf("fetch: %w", context.Canceled), false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"classified retryable", classifiedError{retryable: true}, true},
+		{"classified permanent", fmt.Errorf("fetch: %w", classifiedError{retryable: false}), false},
+		{"plain error", errors.New("bad selector"), false},
+
+		{"unsupported scheme", schemeErr, false},
+		{"malformed url", malformedErr, false},
+		{"untrusted certificate", requestErr(x509.UnknownAuthorityError{}), false},
+		{"host not found", requestErr(&net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}), false},
+		{"request timeout", requestErr(timeoutError{}), true},
+		{"temporary dns failure", requestErr(&net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}), true},
+		{"connection refused", dialErr(syscall.ECONNREFUSED), true},
+		{"connection reset", requestErr(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{"connection closed by server", requestErr(io.EOF), true},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	for code, want := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusBadRequest:          false,
+		http.StatusForbidden:           false,
+		http.StatusNotFound:            false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+	} {
+		if got := RetryableStatus(code); got != want {
+			t.Errorf("RetryableStatus(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		min, max time.Duration
+	}{
+		{"missing", "", 0, 0},
+		{"seconds", "120", 2 * time.Minute, 2 * time.Minute},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"garbage", "soon", 0, 0},
+		{"http date in the future", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+		{"http date in the past", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRetryAfter(tt.header); got < tt.min || got > tt.max {
+				t.Errorf("ParseRetryAfter(%q) = %v, want between %v and %v", tt.header, got, tt.min, tt.max)
+			}
+		})
+	}
+}
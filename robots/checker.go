@@ -0,0 +1,171 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/retry"
+)
+
+const (
+	// cacheTTL is how long a fetched robots.txt is trusted
+	cacheTTL = 24 * time.Hour
+	// unreachableTTL is how long a robots.txt that couldn't be fetched blocks the host
+	unreachableTTL = 10 * time.Minute
+	// maxSize is the part of robots.txt that is parsed, as allowed by RFC 9309
+	maxSize        = 500 * 1024
+	requestTimeout = 15 * time.Second
+)
+
+// Checker decides whether URLs may be crawled, caching robots.txt per host.
+type Checker struct {
+	UserAgent string
+	Client    *http.Client
+	// Retry repeats robots.txt requests that fail with a network or server error
+	Retry retry.Policy
+
+	mu    sync.Mutex
+	cache map[string]*entry
+}
+
+type entry struct {
+	// ready is closed once the robots.txt has been fetched
+	ready   chan struct{}
+	group   Group
+	expires time.Time
+}
+
+// NewChecker creates a Checker that evaluates rules for userAgent.
+func NewChecker(userAgent string) *Checker {
+	return &Checker{
+		UserAgent: userAgent,
+		Client:    &http.Client{Timeout: requestTimeout},
+		Retry:     retry.New(appconfig.RetryConfig{}),
+		cache:     make(map[string]*entry),
+	}
+}
+
+// Check reports whether rawURL may be fetched and the crawl delay requested by its host.
+func (c *Checker) Check(ctx context.Context, rawURL string) (bool, time.Duration, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, 0, fmt.Errorf("error parsing URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return true, 0, nil
+	}
+
+	group, err := c.groupFor(ctx, u.Scheme+"://"+u.Host)
+	if err != nil {
+		return false, 0, err
+	}
+	return group.Allowed(u.RequestURI()), group.CrawlDelay, nil
+}
+
+// groupFor returns the cached rules of a host, fetching them once if needed.
+// The fetch is shared by all callers, so it isn't tied to the context of the one
+// that started it: a cancelled run must not publish "disallow all" to the others.
+func (c *Checker) groupFor(ctx context.Context, origin string) (Group, error) {
+	c.mu.Lock()
+	e, ok := c.cache[origin]
+	if !ok || (isReady(e) && time.Now().After(e.expires)) {
+		e = &entry{ready: make(chan struct{})}
+		c.cache[origin] = e
+		go func() {
+			e.group, e.expires = c.fetch(context.WithoutCancel(ctx), origin)
+			close(e.ready)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.ready:
+		return e.group, nil
+	case <-ctx.Done():
+		return Group{}, ctx.Err()
+	}
+}
+
+// fetch downloads and parses robots.txt following RFC 9309: a missing file allows
+// everything, an unreachable one disallows everything for a while.
+func (c *Checker) fetch(ctx context.Context, origin string) (Group, time.Time) {
+	disallowAll := Group{rules: []rule{{allow: false, pattern: "/"}}}
+
+	var status int
+	var body []byte
+	err := c.Retry.Do(ctx, func() error {
+		var err error
+		status, body, err = c.get(ctx, origin+"/robots.txt")
+		if err == nil && status >= 500 {
+			return &statusError{code: status}
+		}
+		return err
+	})
+
+	var statusErr *statusError
+	switch {
+	case errors.As(err, &statusErr):
+		log.Printf("Server error %d fetching %s/robots.txt", status, origin)
+		return disallowAll, time.Now().Add(unreachableTTL)
+	case err != nil:
+		log.Printf("Error fetching %s/robots.txt: %v", origin, err)
+		return disallowAll, time.Now().Add(unreachableTTL)
+	case status >= 400:
+		return Group{}, time.Now().Add(cacheTTL)
+	}
+	return Parse(body).Group(c.UserAgent), time.Now().Add(cacheTTL)
+}
+
+// get requests robotsURL and reads at most maxSize bytes of the body.
+func (c *Checker) get(ctx context.Context, robotsURL string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return resp.StatusCode, nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return 0, nil, fmt.Errorf("error reading response: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// statusError is a server error answer to a robots.txt request.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.code)
+}
+
+func (e *statusError) Retryable() bool {
+	return true
+}
+
+func isReady(e *entry) bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
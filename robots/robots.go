@@ -0,0 +1,175 @@
+// Package robots fetches, caches and evaluates robots.txt files.
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots is a parsed robots.txt file.
+type Robots struct {
+	groups []group
+}
+
+// Group holds the rules that apply to one user agent.
+type Group struct {
+	rules []rule
+	// CrawlDelay is the requested pause between requests, zero if not set
+	CrawlDelay time.Duration
+}
+
+type group struct {
+	agents []string
+	Group
+}
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// Parse parses a robots.txt file. Unknown lines are ignored, as required by RFC 9309.
+func Parse(data []byte) *Robots {
+	r := &Robots{}
+	var current *group
+	// Consecutive user-agent lines share one group
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !lastWasAgent || current == nil {
+				r.groups = append(r.groups, group{})
+				current = &r.groups[len(r.groups)-1]
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			// An empty disallow allows everything and adds no rule
+			if current != nil && value != "" {
+				current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					current.CrawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+		lastWasAgent = false
+	}
+
+	return r
+}
+
+// Group returns the rules for userAgent: the group naming its product token,
+// or the "*" group, or an empty group that allows everything.
+func (r *Robots) Group(userAgent string) Group {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var result, wildcard Group
+	var found, foundWildcard bool
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			switch {
+			case agent == token:
+				result.rules = append(result.rules, g.rules...)
+				if g.CrawlDelay > result.CrawlDelay {
+					result.CrawlDelay = g.CrawlDelay
+				}
+				found = true
+			case agent == "*":
+				wildcard.rules = append(wildcard.rules, g.rules...)
+				if g.CrawlDelay > wildcard.CrawlDelay {
+					wildcard.CrawlDelay = g.CrawlDelay
+				}
+				foundWildcard = true
+			}
+		}
+	}
+
+	if found {
+		return result
+	}
+	if foundWildcard {
+		return wildcard
+	}
+	return Group{}
+}
+
+// Allowed reports whether path (with its query) may be fetched. The longest matching
+// rule wins, and allow wins over disallow when they are equally long.
+func (g Group) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range g.rules {
+		if !match(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// match matches a robots.txt path pattern, where * matches any sequence
+// and a trailing $ anchors the pattern at the end of the path.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	if !anchored {
+		return matchPrefix(parts, path)
+	}
+	if len(parts) == 1 {
+		return path == parts[0]
+	}
+
+	// The last part has to end the path, the others have to fit before it
+	last := parts[len(parts)-1]
+	if !strings.HasSuffix(path, last) {
+		return false
+	}
+	return matchPrefix(parts[:len(parts)-1], path[:len(path)-len(last)])
+}
+
+// matchPrefix reports whether path starts with parts[0] followed by the other parts in order.
+func matchPrefix(parts []string, path string) bool {
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for _, part := range parts[1:] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/", true},
+		{"/", "/anything", true},
+		{"/events", "/events", true},
+		{"/events", "/events/2024?page=2", true},
+		{"/events", "/event", false},
+		{"/events", "/archive/events", false},
+
+		{"/*.pdf", "/files/program.pdf", true},
+		{"/*.pdf", "/files/program.pdf?download=1", true},
+		{"/*.pdf", "/files/program.html", false},
+		{"/*/private/", "/a/private/b", true},
+		{"/*/private/", "/private/", false},
+		{"*", "/", true},
+		{"/a*b*c", "/a-x-b-y-c", true},
+		{"/a*b*c", "/a-x-c-y-b", false},
+
+		{"/$", "/", true},
+		{"/$", "/index.html", false},
+		{"/*.pdf$", "/files/program.pdf", true},
+		{"/*.pdf$", "/files/program.pdf?download=1", false},
+		{"/events$", "/events", true},
+		{"/events$", "/events/", false},
+		{"/*$", "/anything", true},
+		{"/a*/b$", "/a/x/b", true},
+		{"/a*/b$", "/a/x/b/c", false},
+	}
+
+	for _, tt := range tests {
+		if got := match(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGroupAllowed(t *testing.T) {
+	robots := Parse([]byte(`
+# Comments and unknown lines are ignored
+Sitemap: https://example.com/sitemap.xml
+
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+Disallow: /search?
+Allow: /tickets
+Disallow: /tickets
+Disallow:
+`))
+	group := robots.Group("Ищейкин/1.0")
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"", true},
+		{"/", true},
+		{"/robots.txt", true},
+		{"/events", true},
+		{"/private", false},
+		{"/private/secret", false},
+		// The longest matching rule wins
+		{"/private/open", true},
+		{"/private/open/page", true},
+		{"/programs/2024.pdf", false},
+		{"/programs/2024.pdf?v=2", true},
+		{"/search", true},
+		{"/search?q=concert", false},
+		// Allow wins a tie between equally long rules
+		{"/tickets", true},
+		{"/tickets/42", true},
+	}
+
+	for _, tt := range tests {
+		if got := group.Allowed(tt.path); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsGroup(t *testing.T) {
+	robots := Parse([]byte(`
+User-agent: Googlebot
+User-agent: Crawler
+Disallow: /shared
+Crawl-delay: 2
+
+User-agent: *
+Disallow: /
+Crawl-delay: 10
+
+user-agent: crawler
+disallow: /crawler-only
+crawl-delay: 0.5
+`))
+
+	tests := []struct {
+		name       string
+		userAgent  string
+		allowed    map[string]bool
+		crawlDelay time.Duration
+	}{
+		{
+			name:      "groups naming the product token are merged",
+			userAgent: "Crawler/2.1 (+https://example.com/bot)",
+			allowed: map[string]bool{
+				"/":             true,
+				"/shared":       false,
+				"/crawler-only": false,
+			},
+			crawlDelay: 2 * time.Second,
+		},
+		{
+			name:      "agent with a shared group",
+			userAgent: "googlebot",
+			allowed: map[string]bool{
+				"/":             true,
+				"/shared":       false,
+				"/crawler-only": true,
+			},
+			crawlDelay: 2 * time.Second,
+		},
+		{
+			name:      "other agents use the wildcard group",
+			userAgent: "OtherBot/1.0",
+			allowed: map[string]bool{
+				"/":       false,
+				"/shared": false,
+			},
+			crawlDelay: 10 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := robots.Group(tt.userAgent)
+			for path, want := range tt.allowed {
+				if got := group.Allowed(path); got != want {
+					t.Errorf("Allowed(%q) = %v, want %v", path, got, want)
+				}
+			}
+			if group.CrawlDelay != tt.crawlDelay {
+				t.Errorf("CrawlDelay = %v, want %v", group.CrawlDelay, tt.crawlDelay)
+			}
+		})
+	}
+
+	// Without a matching group everything is allowed
+	group := Parse([]byte("User-agent: Googlebot\nDisallow: /\n")).Group("Crawler")
+	if !group.Allowed("/events") || group.CrawlDelay != 0 {
+		t.Errorf("Group without a match = %+v, want an empty group", group)
+	}
+}
+
+func TestCheckerSharedFetchSurvivesCancelledCaller(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	checker := NewChecker("Crawler/1.0")
+
+	// The first caller starts the fetch and gives up before it completes
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, _, err := checker.Check(ctx, server.URL+"/events")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Check returned %v, want context.Canceled", err)
+	}
+
+	release <- struct{}{}
+	allowed, _, err := checker.Check(context.Background(), server.URL+"/events")
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if !allowed {
+		t.Errorf("Check(/events) = false after the first caller was cancelled, want true")
+	}
+	if allowed, _, _ := checker.Check(context.Background(), server.URL+"/private/page"); allowed {
+		t.Errorf("Check(/private/page) = true, want false")
+	}
+}
@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How often the scheduler checks for due jobs
+const tickInterval = 15 * time.Second
+
+// Job is a recurring crawl for a chat.
+type Job struct {
+	ID     string
+	ChatID int64
+	Spec   string
+	// Global jobs come from the application config and can't be removed from the bot
+	Global bool
+	// Next is the next planned activation, filled in by Jobs
+	Next time.Time
+}
+
+// Trigger starts the crawl of a job and blocks until it is finished.
+type Trigger func(ctx context.Context, job Job)
+
+type entry struct {
+	job      Job
+	schedule Schedule
+	next     time.Time
+	running  bool
+}
+
+// Scheduler triggers jobs according to their schedules. A job that is still
+// running when it is due again is skipped instead of being started twice.
+type Scheduler struct {
+	location *time.Location
+	trigger  Trigger
+
+	mu   sync.Mutex
+	jobs map[string]*entry
+}
+
+// New creates a Scheduler evaluating cron expressions in location.
+func New(location *time.Location, trigger Trigger) *Scheduler {
+	if location == nil {
+		location = time.Local
+	}
+	return &Scheduler{
+		location: location,
+		trigger:  trigger,
+		jobs:     make(map[string]*entry),
+	}
+}
+
+// Add registers a job, replacing an existing job with the same ID.
+func (s *Scheduler) Add(job Job) error {
+	schedule, err := Parse(job.Spec)
+	if err != nil {
+		return err
+	}
+
+	next := schedule.Next(time.Now().In(s.location))
+	if next.IsZero() {
+		return fmt.Errorf("schedule %q never fires", job.Spec)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = &entry{job: job, schedule: schedule, next: next}
+	return nil
+}
+
+// Remove unregisters a job and reports whether it existed.
+func (s *Scheduler) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return false
+	}
+	delete(s.jobs, id)
+	return true
+}
+
+// Jobs returns the registered jobs ordered by ID, with their next activation time.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, e := range s.jobs {
+		job := e.job
+		job.Next = e.next
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// Run checks for due jobs until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runDue(ctx, now.In(s.location))
+		}
+	}
+}
+
+// runDue starts every job whose activation time has come.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, e := range s.jobs {
+		if now.Before(e.next) {
+			continue
+		}
+		e.next = e.schedule.Next(now)
+
+		if e.running {
+			log.Printf("Scheduled job %s is still running, skipping", id)
+			continue
+		}
+		e.running = true
+
+		go func(e *entry) {
+			defer func() {
+				s.mu.Lock()
+				e.running = false
+				s.mu.Unlock()
+			}()
+			log.Printf("Starting scheduled job %s for chat %d", e.job.ID, e.job.ChatID)
+			s.trigger(ctx, e.job)
+		}(e)
+	}
+}
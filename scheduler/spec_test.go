@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNext(t *testing.T) {
+	// Thursday
+	from := time.Date(2024, time.October, 10, 12, 34, 56, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"@every 90m", from, from.Add(90 * time.Minute)},
+		{"@every 1h30m", from, from.Add(90 * time.Minute)},
+		{"  @every 2h  ", from, from.Add(2 * time.Hour)},
+		{"@hourly", from, at(time.October, 10, 13, 0)},
+		{"@daily", from, at(time.October, 11, 0, 0)},
+		{"@weekly", from, at(time.October, 13, 0, 0)},
+
+		{"* * * * *", from, at(time.October, 10, 12, 35)},
+		{"5 * * * *", from, at(time.October, 10, 13, 5)},
+		{"*/15 * * * *", from, at(time.October, 10, 12, 45)},
+		{"10-50/20 * * * *", from, at(time.October, 10, 12, 50)},
+		{"0,30 9-10 * * *", from, at(time.October, 11, 9, 0)},
+		{"0 9 * * 1-5", from, at(time.October, 11, 9, 0)},
+		{"30 8 1 * *", from, at(time.November, 1, 8, 30)},
+		{"0 0 1 1 *", from, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+
+		// Both 0 and 7 are Sunday
+		{"0 0 * * 0", from, at(time.October, 13, 0, 0)},
+		{"0 0 * * 7", from, at(time.October, 13, 0, 0)},
+		// A restricted day of month and weekday match either of them
+		{"0 0 13 * 5", from, at(time.October, 11, 0, 0)},
+		{"0 0 20 * 1", from, at(time.October, 14, 0, 0)},
+		// Only the weekday is restricted
+		{"0 0 * * 6", from, at(time.October, 12, 0, 0)},
+
+		// The next activation is strictly after the given time
+		{"@hourly", at(time.October, 10, 13, 0), at(time.October, 10, 14, 0)},
+		{"0 13 * * *", at(time.October, 10, 13, 0), at(time.October, 11, 13, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.spec, err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Parse(%q).Next(%v) = %v, want %v", tt.spec, tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"@every",
+		"@every soon",
+		"@every 30s",
+		"@monthly",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package spreadsheets
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+// Формат, в котором даты событий передаются в таблицу по умолчанию
+const sheetDateLayout = "2006-01-02 15:04:05"
+
+// Поля события, которые можно вывести в таблицу
+var knownFields = map[string]bool{
+	"title": true, "date": true, "location": true, "link": true, "event_type": true,
+	"price": true, "description": true, "start": true, "end": true, "source": true,
+}
+
+// fieldValue возвращает значение поля события для колонки
+func fieldValue(event appconfig.EventConfig, column appconfig.ColumnConfig) string {
+	switch column.Field {
+	case "title":
+		return event.Title
+	case "date":
+		return event.Date
+	case "location":
+		return event.Location
+	case "link":
+		return event.Link
+	case "event_type":
+		return event.EventType
+	case "price":
+		return event.Price
+	case "description":
+		return event.Description
+	case "start":
+		return formatDate(event.Start, column.DateFormat)
+	case "end":
+		return formatDate(event.End, column.DateFormat)
+	case "source":
+		return event.Source
+	}
+	return ""
+}
+
+// Колонки по умолчанию повторяют прежний порядок полей
+var defaultColumns = []appconfig.ColumnConfig{
+	{Field: "title", Header: "Название"},
+	{Field: "date", Header: "Дата"},
+	{Field: "location", Header: "Место"},
+	{Field: "link", Header: "Ссылка"},
+	{Field: "event_type", Header: "Тип"},
+	{Field: "price", Header: "Цена"},
+	{Field: "description", Header: "Описание"},
+	{Field: "start", Header: "Начало"},
+	{Field: "end", Header: "Окончание"},
+}
+
+// Заголовок скрытой колонки с отпечатком события
+const keyHeader = "key"
+
+// Листы читаются и очищаются в диапазоне A:Z
+const maxColumns = 26
+
+// sheetSchema описывает, какие поля события попадают в какие колонки
+type sheetSchema struct {
+	columns []appconfig.ColumnConfig
+	// keyed добавляет после колонок скрытую колонку с отпечатком события,
+	// по которой режим upsert находит строки независимо от того, как таблица
+	// отображает даты и ссылки и какие колонки настроены
+	keyed bool
+}
+
+// newSchema проверяет настройки колонок и строит по ним схему
+func newSchema(columns []appconfig.ColumnConfig, keyed bool) (*sheetSchema, error) {
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	if keyed && len(columns) >= maxColumns {
+		return nil, fmt.Errorf("upsert mode needs a free column for the event key, at most %d columns are allowed", maxColumns-1)
+	}
+
+	schema := &sheetSchema{columns: columns, keyed: keyed}
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		if !knownFields[column.Field] {
+			return nil, fmt.Errorf("unknown column field %q", column.Field)
+		}
+		if seen[column.Field] {
+			return nil, fmt.Errorf("duplicate column field %q", column.Field)
+		}
+		seen[column.Field] = true
+	}
+
+	return schema, nil
+}
+
+// header возвращает строку заголовков
+func (s *sheetSchema) header() []interface{} {
+	row := make([]interface{}, len(s.columns))
+	for i, column := range s.columns {
+		row[i] = column.Header
+		if column.Header == "" {
+			row[i] = column.Field
+		}
+	}
+	if s.keyed {
+		row = append(row, keyHeader)
+	}
+	return row
+}
+
+// row превращает событие в строку таблицы
+func (s *sheetSchema) row(event appconfig.EventConfig) []interface{} {
+	row := make([]interface{}, len(s.columns))
+	for i, column := range s.columns {
+		value := fieldValue(event, column)
+		switch {
+		case column.Hyperlink && event.Link != "" && value != "":
+			value = hyperlinkFormula(event.Link, value)
+		case column.Field != "start" && column.Field != "end":
+			// Даты формируем сами, остальное взято со страницы и не должно стать формулой
+			value = escapeText(value)
+		}
+		row[i] = value
+	}
+	if s.keyed {
+		// Апостроф не дает таблице принять отпечаток из цифр за число
+		row = append(row, "'"+event.Fingerprint())
+	}
+	return row
+}
+
+// rowKey возвращает отпечаток события, записанного в строке таблицы.
+// У строк без отпечатка, например записанных до его появления, ключ пустой
+func (s *sheetSchema) rowKey(row []interface{}) string {
+	if !s.keyed {
+		return ""
+	}
+	return cellString(row, len(s.columns))
+}
+
+// escapeText защищает текст со страницы от разбора как формулы или числа.
+// Апостроф в начале значения USER_ENTERED таблица не показывает
+func escapeText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@'", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// hyperlinkFormula создает формулу со ссылкой и подписью
+func hyperlinkFormula(link, label string) string {
+	escape := func(s string) string { return strings.ReplaceAll(s, `"`, `""`) }
+	return fmt.Sprintf(`=HYPERLINK("%s","%s")`, escape(link), escape(label))
+}
+
+// cellString возвращает значение ячейки строкой, пустой если ячейки нет.
+// Апостроф экранирования, если он вернулся из таблицы, отбрасывается
+func cellString(row []interface{}, index int) string {
+	if index < 0 || index >= len(row) || row[index] == nil {
+		return ""
+	}
+	return strings.TrimPrefix(fmt.Sprint(row[index]), "'")
+}
+
+// formatDate форматирует дату так, чтобы Google Sheets распознал её как дату.
+// Пустая дата превращается в пустую ячейку
+func formatDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	if layout == "" {
+		layout = sheetDateLayout
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,81 @@
+package spreadsheets
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/retry"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Время на один запрос к API
+const requestTimeout = time.Minute
+
+// newRetryPolicy создает политику повторов для запросов к Google Sheets API
+func newRetryPolicy(cfg appconfig.RetryConfig) retry.Policy {
+	policy := retry.New(cfg)
+	policy.Retryable = isRetryable
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		log.Printf("Google Sheets request failed (attempt %d/%d), retrying in %v: %v", attempt, policy.MaxAttempts, delay.Round(time.Millisecond), err)
+	}
+	return policy
+}
+
+// onlyRateLimited ограничивает политику повторами после 429. Так повторяются
+// неидемпотентные запросы: при ошибке сервера строки могли уже записаться
+func onlyRateLimited(policy retry.Policy) retry.Policy {
+	policy.Retryable = func(err error) bool {
+		var apiErr *googleapi.Error
+		return errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests
+	}
+	return policy
+}
+
+// do выполняет запрос к API, повторяя его по политике. Каждая попытка
+// ограничена requestTimeout, отмена ctx прерывает и запрос, и ожидание
+func do(ctx context.Context, policy retry.Policy, call func(ctx context.Context) error) error {
+	return policy.Do(ctx, func() error {
+		attemptCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+		if err := call(attemptCtx); err != nil {
+			return &apiError{err: err}
+		}
+		return nil
+	})
+}
+
+// isRetryable повторяет превышение квоты, ошибки сервера и сетевые ошибки
+func isRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return retry.RetryableStatus(apiErr.Code)
+	}
+	return retry.IsRetryable(err)
+}
+
+// apiError передает политике повторов заголовок Retry-After ответа API
+type apiError struct {
+	err error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter возвращает задержку, которую запросил сервер
+func (e *apiError) RetryAfter() time.Duration {
+	var apiErr *googleapi.Error
+	if errors.As(e.err, &apiErr) {
+		return retry.ParseRetryAfter(apiErr.Header.Get("Retry-After"))
+	}
+	return 0
+}
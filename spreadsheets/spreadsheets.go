@@ -5,10 +5,12 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
-	"time"
 
 	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/retry"
 
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
@@ -20,24 +22,40 @@ const (
 	googleAuthScope = "https://www.googleapis.com/auth/spreadsheets"
 )
 
+// UnplacedEventsError сообщает о событиях, для типа которых в таблице нет листа
+type UnplacedEventsError struct {
+	// Количество пропущенных событий по типам
+	Counts map[string]int
+}
+
+func (e *UnplacedEventsError) Error() string {
+	eventTypes := make([]string, 0, len(e.Counts))
+	for eventType := range e.Counts {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	parts := make([]string, len(eventTypes))
+	for i, eventType := range eventTypes {
+		parts[i] = fmt.Sprintf("%q: %d", eventType, e.Counts[eventType])
+	}
+	return "no sheet for event types " + strings.Join(parts, ", ")
+}
+
 // sheetDetails содержит информацию о листе Google Sheets
 type sheetDetails struct {
 	Id    int64
 	Title string
 }
 
-// WriteToSpreadsheet записывает события в Google Sheets
-func WriteToSpreadsheet(events []appconfig.EventConfig, crawlerAppConfig appconfig.AppConfig) error {
+// WriteToSpreadsheet записывает события в Google Sheets. Отмена ctx прерывает запись
+func WriteToSpreadsheet(ctx context.Context, events []appconfig.EventConfig, crawlerAppConfig appconfig.AppConfig) error {
 	// Декодируем ключ авторизации из base64
 	credBytes, err := base64.StdEncoding.DecodeString(crawlerAppConfig.GoogleAuthKey)
 	if err != nil {
 		return fmt.Errorf("error decoding key JSON: %v", err)
 	}
 
-	// Создаем контекст с тайм-аутом
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	// Создаем конфигурацию для авторизации через JWT
 	config, err := google.JWTConfigFromJSON(credBytes, googleAuthScope)
 	if err != nil {
@@ -55,15 +73,34 @@ func WriteToSpreadsheet(events []appconfig.EventConfig, crawlerAppConfig appconf
 
 	log.Println("Getting data from Google API")
 
+	// Политика повторов для всех запросов к API
+	policy := newRetryPolicy(crawlerAppConfig.Retry)
+
 	// Получаем информацию о листах в таблице(id и названия листов)
-	sheetNamesById, err := getSheetNames(service, crawlerAppConfig.SpreadsheetID)
+	sheetNamesById, err := getSheetNames(ctx, service, policy, crawlerAppConfig.SpreadsheetID)
 	if err != nil {
 		return err
 	}
 	log.Printf("sheetNames: %v", sheetNamesById)
 
+	// Строим схему колонок из настроек
+	schema, err := newSchema(crawlerAppConfig.SheetColumns, crawlerAppConfig.SheetWriteMode == appconfig.WriteModeUpsert)
+	if err != nil {
+		return err
+	}
+
 	// Группируем события по типам
-	eventGroups := groupEventsByType(events)
+	eventGroups := groupEventsByType(events, schema)
+
+	// Создаем недостающие листы, если это разрешено настройками
+	if crawlerAppConfig.CreateMissingSheets {
+		if err := addMissingSheets(ctx, service, policy, crawlerAppConfig.SpreadsheetID, eventGroups, sheetNamesById); err != nil {
+			return err
+		}
+	}
+
+	// События, для которых не нашлось листа
+	unplaced := &UnplacedEventsError{Counts: make(map[string]int)}
 
 	var wg sync.WaitGroup
 
@@ -75,11 +112,14 @@ func WriteToSpreadsheet(events []appconfig.EventConfig, crawlerAppConfig appconf
 			wg.Add(1)
 			go func(eventType string, details sheetDetails, events [][]interface{}) {
 				defer wg.Done()
-				if err := saveToSheet(service, crawlerAppConfig.SpreadsheetID, details.Title, events); err != nil {
+				if err := saveToSheet(ctx, service, policy, crawlerAppConfig.SpreadsheetID, details, schema, events, crawlerAppConfig.SheetWriteMode); err != nil {
 					errChan <- fmt.Errorf("unable to save events to sheet %s: %v", details.Title, err)
 				}
 				log.Printf("Events saved to sheet %s successfully", details.Title)
 			}(eventType, details, events)
+		} else {
+			log.Printf("No sheet for event type %q, %d events skipped", eventType, len(events))
+			unplaced.Counts[eventType] = len(events)
 		}
 	}
 
@@ -92,24 +132,27 @@ func WriteToSpreadsheet(events []appconfig.EventConfig, crawlerAppConfig appconf
 		for err := range errChan {
 			errMsg += err.Error() + "\n"
 		}
+		if len(unplaced.Counts) > 0 {
+			errMsg += unplaced.Error() + "\n"
+		}
 		return fmt.Errorf("errors occurred: %v", errMsg)
 	}
 
+	if len(unplaced.Counts) > 0 {
+		return unplaced
+	}
+
 	return nil
 }
 
 // ClearAllSheets очищает все листы в таблице Google Sheets
-func ClearAllSheets(crawlerAppConfig appconfig.AppConfig) error {
+func ClearAllSheets(ctx context.Context, crawlerAppConfig appconfig.AppConfig) error {
 	// Декодируем ключ авторизации из base64
 	credBytes, err := base64.StdEncoding.DecodeString(crawlerAppConfig.GoogleAuthKey)
 	if err != nil {
 		return fmt.Errorf("error decoding key JSON: %v", err)
 	}
 
-	// Создаем контекст с тайм-аутом
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	// Создаем конфигурацию для авторизации через JWT
 	config, err := google.JWTConfigFromJSON(credBytes, googleAuthScope)
 	if err != nil {
@@ -127,17 +170,23 @@ func ClearAllSheets(crawlerAppConfig appconfig.AppConfig) error {
 
 	log.Println("Getting data from Google API")
 
+	// Политика повторов для всех запросов к API
+	policy := newRetryPolicy(crawlerAppConfig.Retry)
+
 	// Получаем информацию о листах в таблице(id и названия листов)
-	sheetNamesById, err := getSheetNames(service, crawlerAppConfig.SpreadsheetID)
+	sheetNamesById, err := getSheetNames(ctx, service, policy, crawlerAppConfig.SpreadsheetID)
 	if err != nil {
 		return err
 	}
 	log.Printf("sheetNames: %v", sheetNamesById)
 
 	for _, details := range sheetNamesById {
-		clearRange := fmt.Sprintf("%s!A:Z", details.Title)
+		clearRange := sheetRange(details.Title, "A:Z")
 		clearRequest := &sheets.ClearValuesRequest{}
-		_, err := service.Spreadsheets.Values.Clear(crawlerAppConfig.SpreadsheetID, clearRange, clearRequest).Do()
+		err := do(ctx, policy, func(ctx context.Context) error {
+			_, err := service.Spreadsheets.Values.Clear(crawlerAppConfig.SpreadsheetID, clearRange, clearRequest).Context(ctx).Do()
+			return err
+		})
 		if err != nil {
 			return fmt.Errorf("unable to clear sheet %s: %v", details.Title, err)
 		}
@@ -147,9 +196,56 @@ func ClearAllSheets(crawlerAppConfig appconfig.AppConfig) error {
 	return nil
 }
 
+// addMissingSheets создает листы для типов событий, у которых их еще нет,
+// и добавляет их в sheetNamesById
+func addMissingSheets(ctx context.Context, service *sheets.Service, policy retry.Policy, spreadsheetId string, eventGroups map[string][][]interface{}, sheetNamesById map[string]sheetDetails) error {
+	var requests []*sheets.Request
+	for eventType := range eventGroups {
+		if _, exists := sheetNamesById[eventType]; exists || strings.TrimSpace(eventType) == "" {
+			continue
+		}
+		requests = append(requests, &sheets.Request{
+			AddSheet: &sheets.AddSheetRequest{
+				Properties: &sheets.SheetProperties{Title: eventType},
+			},
+		})
+	}
+
+	if len(requests) == 0 {
+		return nil
+	}
+
+	// Повторяем только после превышения квоты: при ошибке сервера листы могли уже создаться
+	var resp *sheets.BatchUpdateSpreadsheetResponse
+	err := do(ctx, onlyRateLimited(policy), func(ctx context.Context) error {
+		var err error
+		resp, err = service.Spreadsheets.BatchUpdate(spreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create missing sheets: %v", err)
+	}
+
+	for _, reply := range resp.Replies {
+		if reply.AddSheet == nil || reply.AddSheet.Properties == nil {
+			continue
+		}
+		props := reply.AddSheet.Properties
+		sheetNamesById[props.Title] = sheetDetails{Id: props.SheetId, Title: props.Title}
+		log.Printf("Sheet %s created", props.Title)
+	}
+
+	return nil
+}
+
 // getSheetNames получает имена листов в таблице Google Sheets
-func getSheetNames(service *sheets.Service, spreadsheetId string) (map[string]sheetDetails, error) {
-	res, err := service.Spreadsheets.Get(spreadsheetId).Fields("sheets(properties(sheetId,title))").Do()
+func getSheetNames(ctx context.Context, service *sheets.Service, policy retry.Policy, spreadsheetId string) (map[string]sheetDetails, error) {
+	var res *sheets.Spreadsheet
+	err := do(ctx, policy, func(ctx context.Context) error {
+		var err error
+		res, err = service.Spreadsheets.Get(spreadsheetId).Fields("sheets(properties(sheetId,title))").Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error getting spreadsheet: %v", err)
 	}
@@ -165,33 +261,37 @@ func getSheetNames(service *sheets.Service, spreadsheetId string) (map[string]sh
 }
 
 // groupEventsByType группирует события по их типам
-func groupEventsByType(events []appconfig.EventConfig) map[string][][]interface{} {
+func groupEventsByType(events []appconfig.EventConfig, schema *sheetSchema) map[string][][]interface{} {
 	eventGroups := make(map[string][][]interface{})
 
 	// Для каждого события создаем строку и добавляем в соответствующую группу
 	for _, event := range events {
-		row := []interface{}{event.Title, event.Date, event.Location, event.Link, event.EventType}
-		eventGroups[event.EventType] = append(eventGroups[event.EventType], row)
+		eventGroups[event.EventType] = append(eventGroups[event.EventType], schema.row(event))
 	}
 
 	return eventGroups
 }
 
-// saveToSheet записывает данные в указанный лист Google Sheets
-func saveToSheet(service *sheets.Service, spreadsheetId, sheetName string, data [][]interface{}) error {
-	writeRange := fmt.Sprintf("%s!A1", sheetName)
-
-	valueRange := &sheets.ValueRange{
-		Values: data,
+// saveToSheet записывает данные в указанный лист Google Sheets в заданном режиме
+// и закрепляет строку заголовков
+func saveToSheet(ctx context.Context, service *sheets.Service, policy retry.Policy, spreadsheetId string, details sheetDetails, schema *sheetSchema, data [][]interface{}, writeMode string) error {
+	var err error
+	switch writeMode {
+	case appconfig.WriteModeAppend:
+		err = appendToSheet(ctx, service, policy, spreadsheetId, details.Title, schema, data)
+	case appconfig.WriteModeUpsert:
+		err = upsertSheet(ctx, service, policy, spreadsheetId, details.Title, schema, data)
+	default:
+		err = overwriteSheet(ctx, service, policy, spreadsheetId, details.Title, schema, data)
+	}
+	if err == nil {
+		err = freezeHeader(ctx, service, policy, spreadsheetId, details.Id, schema)
 	}
-
-	// Обновляем значения в указанном диапазоне листа
-	_, err := service.Spreadsheets.Values.Update(spreadsheetId, writeRange, valueRange).ValueInputOption("RAW").Do()
 	if err != nil {
 		log.Printf("unable to write data to spreadsheet: %v", err)
 		return fmt.Errorf("unable to write data to spreadsheet: %v", err)
 	}
 
-	log.Printf("Data written to spreadsheet %s in range %s", spreadsheetId, writeRange)
+	log.Printf("Data written to spreadsheet %s, sheet %s (mode %s)", spreadsheetId, details.Title, writeMode)
 	return nil
 }
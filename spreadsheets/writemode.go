@@ -0,0 +1,167 @@
+package spreadsheets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rx3lixir/crawler/retry"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Ввод значений как с клавиатуры, чтобы даты сохранялись как даты, а формулы работали.
+// Текст со страниц экранируется в sheetSchema.row, формулами остаются только наши HYPERLINK
+const valueInputOption = "USER_ENTERED"
+
+// sheetRange строит диапазон в нотации A1. Название листа всегда в кавычках,
+// иначе листы с пробелами, дефисами или похожие на ячейку ("A1") не находятся
+func sheetRange(sheetName, cells string) string {
+	return "'" + strings.ReplaceAll(sheetName, "'", "''") + "'!" + cells
+}
+
+// overwriteSheet очищает лист и записывает заголовок и данные с первой строки
+func overwriteSheet(ctx context.Context, service *sheets.Service, policy retry.Policy, spreadsheetId, sheetName string, schema *sheetSchema, data [][]interface{}) error {
+	clearRange := sheetRange(sheetName, "A:Z")
+	err := do(ctx, policy, func(ctx context.Context) error {
+		_, err := service.Spreadsheets.Values.Clear(spreadsheetId, clearRange, &sheets.ClearValuesRequest{}).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to clear sheet %s: %v", sheetName, err)
+	}
+
+	writeRange := sheetRange(sheetName, "A1")
+	valueRange := &sheets.ValueRange{Values: append([][]interface{}{schema.header()}, data...)}
+	return do(ctx, policy, func(ctx context.Context) error {
+		_, err := service.Spreadsheets.Values.Update(spreadsheetId, writeRange, valueRange).ValueInputOption(valueInputOption).Context(ctx).Do()
+		return err
+	})
+}
+
+// appendToSheet дописывает данные после последней заполненной строки листа.
+// На пустой лист сначала записывается заголовок. Дописывание повторяется
+// только после превышения квоты, чтобы строки не задублировались
+func appendToSheet(ctx context.Context, service *sheets.Service, policy retry.Policy, spreadsheetId, sheetName string, schema *sheetSchema, data [][]interface{}) error {
+	var firstRow *sheets.ValueRange
+	err := do(ctx, policy, func(ctx context.Context) error {
+		var err error
+		firstRow, err = service.Spreadsheets.Values.Get(spreadsheetId, sheetRange(sheetName, "1:1")).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read sheet %s: %v", sheetName, err)
+	}
+	if len(firstRow.Values) == 0 {
+		data = append([][]interface{}{schema.header()}, data...)
+	}
+
+	writeRange := sheetRange(sheetName, "A1")
+	valueRange := &sheets.ValueRange{Values: data}
+	return do(ctx, onlyRateLimited(policy), func(ctx context.Context) error {
+		_, err := service.Spreadsheets.Values.Append(spreadsheetId, writeRange, valueRange).
+			ValueInputOption(valueInputOption).
+			InsertDataOption("INSERT_ROWS").
+			Context(ctx).
+			Do()
+		return err
+	})
+}
+
+// upsertSheet обновляет строки уже известных событий и дописывает новые.
+// Лист читается один раз, а все изменения, включая заголовок в первой строке,
+// отправляются одним BatchUpdate
+func upsertSheet(ctx context.Context, service *sheets.Service, policy retry.Policy, spreadsheetId, sheetName string, schema *sheetSchema, data [][]interface{}) error {
+	// Строки сопоставляются по скрытой колонке с отпечатком, остальные колонки
+	// нужны только чтобы знать, сколько строк уже занято
+	readRange := sheetRange(sheetName, "A:Z")
+	var existing *sheets.ValueRange
+	err := do(ctx, policy, func(ctx context.Context) error {
+		var err error
+		existing, err = service.Spreadsheets.Values.Get(spreadsheetId, readRange).ValueRenderOption("UNFORMATTED_VALUE").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read sheet %s: %v", sheetName, err)
+	}
+
+	// Номер строки (с единицы) для каждого события на листе, первая строка — заголовок
+	rowsByKey := make(map[string]int, len(existing.Values))
+	for i, row := range existing.Values {
+		key := schema.rowKey(row)
+		if i == 0 || key == "" {
+			continue
+		}
+		rowsByKey[key] = i + 1
+	}
+
+	updates := []*sheets.ValueRange{{
+		Range:  sheetRange(sheetName, "A1"),
+		Values: [][]interface{}{schema.header()},
+	}}
+
+	nextRow := len(existing.Values) + 1
+	if nextRow < 2 {
+		nextRow = 2
+	}
+	for _, row := range data {
+		key := schema.rowKey(row)
+		rowNumber, found := rowsByKey[key]
+		if !found {
+			rowNumber = nextRow
+			nextRow++
+			rowsByKey[key] = rowNumber
+		}
+		updates = append(updates, &sheets.ValueRange{
+			Range:  sheetRange(sheetName, fmt.Sprintf("A%d", rowNumber)),
+			Values: [][]interface{}{row},
+		})
+	}
+
+	request := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: valueInputOption,
+		Data:             updates,
+	}
+	return do(ctx, policy, func(ctx context.Context) error {
+		_, err := service.Spreadsheets.Values.BatchUpdate(spreadsheetId, request).Context(ctx).Do()
+		return err
+	})
+}
+
+// freezeHeader закрепляет первую строку листа и скрывает колонку с отпечатками
+func freezeHeader(ctx context.Context, service *sheets.Service, policy retry.Policy, spreadsheetId string, sheetId int64, schema *sheetSchema) error {
+	request := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Properties: &sheets.SheetProperties{
+					SheetId:        sheetId,
+					GridProperties: &sheets.GridProperties{FrozenRowCount: 1},
+				},
+				Fields: "gridProperties.frozenRowCount",
+			},
+		}},
+	}
+	if schema.keyed {
+		keyColumn := int64(len(schema.columns))
+		request.Requests = append(request.Requests, &sheets.Request{
+			UpdateDimensionProperties: &sheets.UpdateDimensionPropertiesRequest{
+				Range: &sheets.DimensionRange{
+					SheetId:    sheetId,
+					Dimension:  "COLUMNS",
+					StartIndex: keyColumn,
+					EndIndex:   keyColumn + 1,
+				},
+				Properties: &sheets.DimensionProperties{HiddenByUser: true},
+				Fields:     "hiddenByUser",
+			},
+		})
+	}
+	err := do(ctx, policy, func(ctx context.Context) error {
+		_, err := service.Spreadsheets.BatchUpdate(spreadsheetId, request).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to freeze header of sheet %d: %v", sheetId, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var accessBucket = []byte("access")
+
+// Grant is a role given to a Telegram user or chat at runtime.
+type Grant struct {
+	// Subject is either "user" or "chat"
+	Subject   string    `json:"subject"`
+	ID        int64     `json:"id"`
+	Role      string    `json:"role"`
+	GrantedBy int64     `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// Subjects a grant can apply to
+const (
+	SubjectUser = "user"
+	SubjectChat = "chat"
+)
+
+// SaveGrant stores a grant, replacing an existing one for the same subject.
+func (s *Store) SaveGrant(grant Grant) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(accessBucket), grantKey(grant.Subject, grant.ID), grant)
+	})
+	if err != nil {
+		return fmt.Errorf("error saving grant: %v", err)
+	}
+	return nil
+}
+
+// DeleteGrant removes the grant of a subject and reports whether it existed.
+func (s *Store) DeleteGrant(subject string, id int64) (bool, error) {
+	var existed bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(accessBucket)
+		key := grantKey(subject, id)
+		existed = bucket.Get(key) != nil
+		return bucket.Delete(key)
+	})
+	if err != nil {
+		return false, fmt.Errorf("error deleting grant: %v", err)
+	}
+	return existed, nil
+}
+
+// Grants returns all runtime grants.
+func (s *Store) Grants() ([]Grant, error) {
+	var grants []Grant
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(accessBucket).ForEach(func(k, v []byte) error {
+			var grant Grant
+			if err := json.Unmarshal(v, &grant); err != nil {
+				return err
+			}
+			grants = append(grants, grant)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading grants: %v", err)
+	}
+	return grants, nil
+}
+
+func grantKey(subject string, id int64) []byte {
+	return []byte(strings.ToLower(subject) + ":" + strconv.FormatInt(id, 10))
+}
@@ -0,0 +1,68 @@
+package storage
+
+import "github.com/rx3lixir/crawler/appconfig"
+
+// Diff lists the differences between the events of two runs.
+// Events are matched by their fingerprint.
+type Diff struct {
+	Added   []appconfig.EventConfig
+	Removed []appconfig.EventConfig
+	Changed []EventChange
+}
+
+// EventChange holds both versions of an event whose details changed between runs.
+type EventChange struct {
+	Before appconfig.EventConfig
+	After  appconfig.EventConfig
+}
+
+// IsEmpty reports whether the runs found the same events.
+func (d Diff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffEvents compares two sets of events. The order of current is preserved in Added and Changed.
+func DiffEvents(previous, current []appconfig.EventConfig) Diff {
+	var diff Diff
+
+	previousByKey := make(map[string]appconfig.EventConfig, len(previous))
+	for _, event := range previous {
+		previousByKey[event.Fingerprint()] = event
+	}
+
+	seen := make(map[string]bool, len(current))
+	for _, event := range current {
+		key := event.Fingerprint()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		before, existed := previousByKey[key]
+		switch {
+		case !existed:
+			diff.Added = append(diff.Added, event)
+		case detailsChanged(before, event):
+			diff.Changed = append(diff.Changed, EventChange{Before: before, After: event})
+		}
+	}
+
+	for _, event := range previous {
+		key := event.Fingerprint()
+		if !seen[key] {
+			seen[key] = true
+			diff.Removed = append(diff.Removed, event)
+		}
+	}
+
+	return diff
+}
+
+// detailsChanged compares the fields that are not part of the fingerprint.
+func detailsChanged(before, after appconfig.EventConfig) bool {
+	return before.Location != after.Location ||
+		before.Price != after.Price ||
+		before.Description != after.Description ||
+		before.EventType != after.EventType ||
+		!before.End.Equal(after.End)
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var schedulesBucket = []byte("schedules")
+
+// ScheduleRecord is a recurring crawl added from a chat.
+type ScheduleRecord struct {
+	ID        uint64    `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	Spec      string    `json:"spec"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddSchedule saves a new schedule and returns it with its ID set.
+func (s *Store) AddSchedule(record ScheduleRecord) (ScheduleRecord, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schedulesBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		record.ID = id
+		return putJSON(bucket, itob(id), record)
+	})
+	if err != nil {
+		return ScheduleRecord{}, fmt.Errorf("error saving schedule: %v", err)
+	}
+	return record, nil
+}
+
+// DeleteSchedule removes a schedule of a chat and reports whether it existed.
+func (s *Store) DeleteSchedule(chatID int64, id uint64) (bool, error) {
+	var existed bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schedulesBucket)
+		raw := bucket.Get(itob(id))
+		if raw == nil {
+			return nil
+		}
+
+		var record ScheduleRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return err
+		}
+		if record.ChatID != chatID {
+			return nil
+		}
+
+		existed = true
+		return bucket.Delete(itob(id))
+	})
+	if err != nil {
+		return false, fmt.Errorf("error deleting schedule: %v", err)
+	}
+	return existed, nil
+}
+
+// Schedules returns all saved schedules.
+func (s *Store) Schedules() ([]ScheduleRecord, error) {
+	var records []ScheduleRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).ForEach(func(k, v []byte) error {
+			var record ScheduleRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading schedules: %v", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	bolt "go.etcd.io/bbolt"
+)
+
+var sessionsBucket = []byte("sessions")
+
+// Session holds the settings and state of a single Telegram chat.
+type Session struct {
+	ChatID      int64                  `json:"chat_id"`
+	SiteConfigs []appconfig.SiteConfig `json:"site_configs"`
+	// SpreadsheetID overrides the spreadsheet from the application config
+	SpreadsheetID string    `json:"spreadsheet_id"`
+	LastRunID     uint64    `json:"last_run_id"`
+	LastRunAt     time.Time `json:"last_run_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Session returns the session of a chat, an empty one if the chat has none yet.
+func (s *Store) Session(chatID int64) (Session, error) {
+	session := Session{ChatID: chatID}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(sessionsBucket).Get(chatKey(chatID))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &session)
+	})
+	if err != nil {
+		return Session{}, fmt.Errorf("error reading session of chat %d: %v", chatID, err)
+	}
+	return session, nil
+}
+
+// UpdateSession applies fn to the session of a chat and saves the result atomically.
+func (s *Store) UpdateSession(chatID int64, fn func(session *Session)) (Session, error) {
+	session := Session{ChatID: chatID}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		if raw := bucket.Get(chatKey(chatID)); raw != nil {
+			if err := json.Unmarshal(raw, &session); err != nil {
+				return err
+			}
+		}
+
+		fn(&session)
+		session.ChatID = chatID
+		session.UpdatedAt = time.Now()
+
+		return putJSON(bucket, chatKey(chatID), session)
+	})
+	if err != nil {
+		return Session{}, fmt.Errorf("error saving session of chat %d: %v", chatID, err)
+	}
+	return session, nil
+}
+
+func chatKey(chatID int64) []byte {
+	return []byte(strconv.FormatInt(chatID, 10))
+}
@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	runsBucket      = []byte("runs")
+	eventsBucket    = []byte("events")
+	runEventsBucket = []byte("run_events")
+)
+
+// Run describes a single crawl.
+type Run struct {
+	ID uint64 `json:"id"`
+	// ChatID is the Telegram chat that started the run, 0 for runs outside the bot
+	ChatID     int64     `json:"chat_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Sites      []string  `json:"sites"`
+	EventCount int       `json:"event_count"`
+	// Reports describes how each site went, in the order of Sites
+	Reports []appconfig.SiteReport `json:"reports,omitempty"`
+}
+
+// StoredEvent is an event together with its history across runs.
+type StoredEvent struct {
+	Fingerprint string                `json:"fingerprint"`
+	Event       appconfig.EventConfig `json:"event"`
+	FirstSeen   time.Time             `json:"first_seen"`
+	LastSeen    time.Time             `json:"last_seen"`
+	FirstRunID  uint64                `json:"first_run_id"`
+	LastRunID   uint64                `json:"last_run_id"`
+}
+
+// Store keeps runs and events in an embedded bbolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the database at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening store %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{runsBucket, eventsBucket, runEventsBucket, sessionsBucket, accessBucket, schedulesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initializing store: %v", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// RecordRun saves a finished run with the events it found and returns the run with its ID set.
+// Events seen before keep their first-seen timestamp; new ones start their history with this run.
+func (s *Store) RecordRun(run Run, events []appconfig.EventConfig) (Run, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+		id, err := runs.NextSequence()
+		if err != nil {
+			return err
+		}
+		run.ID = id
+		run.EventCount = len(events)
+
+		seenAt := run.FinishedAt
+		if seenAt.IsZero() {
+			seenAt = run.StartedAt
+		}
+
+		stored := tx.Bucket(eventsBucket)
+		for _, event := range events {
+			fingerprint := event.Fingerprint()
+
+			record := StoredEvent{
+				Fingerprint: fingerprint,
+				FirstSeen:   seenAt,
+				FirstRunID:  run.ID,
+			}
+			if existing := stored.Get([]byte(fingerprint)); existing != nil {
+				if err := json.Unmarshal(existing, &record); err != nil {
+					return fmt.Errorf("error decoding event %s: %v", fingerprint, err)
+				}
+			}
+			record.Event = event
+			record.LastSeen = seenAt
+			record.LastRunID = run.ID
+
+			if err := putJSON(stored, []byte(fingerprint), record); err != nil {
+				return err
+			}
+		}
+
+		// Keep a snapshot of the events as they were in this run
+		if err := putJSON(tx.Bucket(runEventsBucket), itob(run.ID), events); err != nil {
+			return err
+		}
+		return putJSON(runs, itob(run.ID), run)
+	})
+	if err != nil {
+		return Run{}, fmt.Errorf("error recording run: %v", err)
+	}
+
+	return run, nil
+}
+
+// Runs returns up to limit most recent runs, newest first. A limit of 0 returns all runs.
+func (s *Store) Runs(limit int) ([]Run, error) {
+	var runs []Run
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var run Run
+			if err := json.Unmarshal(v, &run); err != nil {
+				return fmt.Errorf("error decoding run: %v", err)
+			}
+			runs = append(runs, run)
+			if limit > 0 && len(runs) == limit {
+				break
+			}
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// Run returns a recorded run by its ID.
+func (s *Store) Run(runID uint64) (Run, bool, error) {
+	var run Run
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(runsBucket).Get(itob(runID))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(raw, &run)
+	})
+	return run, found, err
+}
+
+// RunEvents returns the events as they were found by a run.
+func (s *Store) RunEvents(runID uint64) ([]appconfig.EventConfig, error) {
+	var events []appconfig.EventConfig
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(runEventsBucket).Get(itob(runID))
+		if raw == nil {
+			return fmt.Errorf("run %d not found", runID)
+		}
+		if err := json.Unmarshal(raw, &events); err != nil {
+			return fmt.Errorf("error decoding run %d: %v", runID, err)
+		}
+		return nil
+	})
+	return events, err
+}
+
+// PreviousRun returns the latest run of the same chat recorded before runID, if any.
+func (s *Store) PreviousRun(runID uint64) (Run, bool, error) {
+	var previous Run
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+
+		var current Run
+		raw := runs.Get(itob(runID))
+		if raw == nil {
+			return fmt.Errorf("run %d not found", runID)
+		}
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return err
+		}
+
+		c := runs.Cursor()
+		c.Seek(itob(runID))
+		for k, v := c.Prev(); k != nil; k, v = c.Prev() {
+			var run Run
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if run.ChatID == current.ChatID {
+				previous, found = run, true
+				return nil
+			}
+		}
+		return nil
+	})
+	return previous, found, err
+}
+
+// DiffWithPrevious compares the events of a run with the previous run of the same chat.
+// For the very first run every event counts as added. Sites that failed in either run
+// are left out, so that a transient failure doesn't show their events as removed and added again.
+func (s *Store) DiffWithPrevious(runID uint64) (Diff, error) {
+	current, err := s.RunEvents(runID)
+	if err != nil {
+		return Diff{}, err
+	}
+	currentRun, _, err := s.Run(runID)
+	if err != nil {
+		return Diff{}, err
+	}
+	failed := make(map[string]bool)
+	addFailedSites(failed, currentRun)
+
+	var previous []appconfig.EventConfig
+	previousRun, found, err := s.PreviousRun(runID)
+	if err != nil {
+		return Diff{}, fmt.Errorf("error finding previous run: %v", err)
+	}
+	if found {
+		if previous, err = s.RunEvents(previousRun.ID); err != nil {
+			return Diff{}, err
+		}
+		addFailedSites(failed, previousRun)
+	}
+
+	return DiffEvents(withoutSites(previous, failed), withoutSites(current, failed)), nil
+}
+
+// addFailedSites adds the sites of a run that didn't finish with a usable result.
+func addFailedSites(failed map[string]bool, run Run) {
+	for _, report := range run.Reports {
+		if report.Status != appconfig.SiteOK && report.Status != appconfig.SiteEmpty {
+			failed[siteKey(report.URL, report.EventType)] = true
+		}
+	}
+}
+
+// withoutSites drops the events found by the given sites.
+func withoutSites(events []appconfig.EventConfig, sites map[string]bool) []appconfig.EventConfig {
+	if len(sites) == 0 {
+		return events
+	}
+	var kept []appconfig.EventConfig
+	for _, event := range events {
+		if !sites[siteKey(event.Source, event.EventType)] {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+func siteKey(url, eventType string) string {
+	return url + "\n" + eventType
+}
+
+// Event returns the stored history of an event by its fingerprint.
+func (s *Store) Event(fingerprint string) (StoredEvent, bool, error) {
+	var event StoredEvent
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(eventsBucket).Get([]byte(fingerprint))
+		if raw == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(raw, &event)
+	})
+	return event, found, err
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// itob encodes an ID as a big-endian key so that runs are ordered by ID.
+func itob(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
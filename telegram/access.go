@@ -0,0 +1,193 @@
+package telegram
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/storage"
+)
+
+// Уровни ролей: каждая следующая включает права предыдущей
+var roleLevels = map[string]int{
+	"":                     0,
+	appconfig.RoleViewer:   1,
+	appconfig.RoleOperator: 2,
+	appconfig.RoleAdmin:    3,
+}
+
+// Минимальная роль, необходимая для команды. Команды без записи доступны всем
+var commandRoles = map[string]string{
+	"status":   appconfig.RoleViewer,
+	"run":      appconfig.RoleOperator,
+	"config":   appconfig.RoleOperator,
+	"cancel":   appconfig.RoleOperator,
+	"sheet":    appconfig.RoleOperator,
+	"schedule": appconfig.RoleOperator,
+	"test":     appconfig.RoleOperator,
+	"clear":    appconfig.RoleAdmin,
+	"reset":    appconfig.RoleAdmin,
+	"grant":    appconfig.RoleAdmin,
+	"revoke":   appconfig.RoleAdmin,
+	"access":   appconfig.RoleAdmin,
+}
+
+// Роль, необходимая для загрузки файла конфигурации
+const uploadRole = appconfig.RoleOperator
+
+// roleOf возвращает наивысшую роль пользователя с учетом прав, выданных ему лично и его чату
+func roleOf(crawlerAppConfig appconfig.AppConfig, userID, chatID int64) string {
+	best := ""
+	consider := func(role string) {
+		if roleLevels[role] > roleLevels[best] {
+			best = role
+		}
+	}
+
+	for _, entry := range crawlerAppConfig.Access {
+		if (entry.UserID != 0 && entry.UserID == userID) || (entry.ChatID != 0 && entry.ChatID == chatID) {
+			consider(entry.Role)
+		}
+	}
+
+	grants, err := eventStore.Grants()
+	if err != nil {
+		log.Printf("Error loading grants: %v", err)
+		return best
+	}
+	for _, grant := range grants {
+		if (grant.Subject == storage.SubjectUser && grant.ID == userID) || (grant.Subject == storage.SubjectChat && grant.ID == chatID) {
+			consider(grant.Role)
+		}
+	}
+
+	return best
+}
+
+// authorize проверяет, что у автора сообщения есть нужная роль, и сообщает об отказе
+func authorize(bot *tgbotapi.BotAPI, message *tgbotapi.Message, crawlerAppConfig appconfig.AppConfig, required string) bool {
+	if required == "" {
+		return true
+	}
+
+	var userID int64
+	if message.From != nil {
+		userID = message.From.ID
+	}
+
+	role := roleOf(crawlerAppConfig, userID, message.Chat.ID)
+	if roleLevels[role] >= roleLevels[required] {
+		return true
+	}
+
+	log.Printf("Access denied: user %d in chat %d has role %q, %q required", userID, message.Chat.ID, role, required)
+	sendMessageHandler(bot, message.Chat.ID, fmt.Sprintf("Недостаточно прав: нужна роль %s. Ваш ID: %d, ID чата: %d", required, userID, message.Chat.ID))
+	return false
+}
+
+// parseSubject разбирает аргументы вида "[user|chat] <id>"
+func parseSubject(args []string) (string, int64, []string, error) {
+	subject := storage.SubjectUser
+	if len(args) > 0 && (args[0] == storage.SubjectUser || args[0] == storage.SubjectChat) {
+		subject = args[0]
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return "", 0, nil, fmt.Errorf("не указан ID")
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id == 0 {
+		return "", 0, nil, fmt.Errorf("неверный ID %q", args[0])
+	}
+	return subject, id, args[1:], nil
+}
+
+// Выдает роль пользователю или чату: /grant [user|chat] <id> <role>
+func grantHandler(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	usage := "Использование: /grant [user|chat] <id> <viewer|operator|admin>"
+
+	subject, id, rest, err := parseSubject(strings.Fields(strings.ToLower(message.CommandArguments())))
+	if err != nil || len(rest) != 1 || !appconfig.ValidRole(rest[0]) {
+		sendMessageHandler(bot, chatID, usage)
+		return
+	}
+
+	grant := storage.Grant{Subject: subject, ID: id, Role: rest[0], GrantedAt: time.Now()}
+	if message.From != nil {
+		grant.GrantedBy = message.From.ID
+	}
+	if err := eventStore.SaveGrant(grant); err != nil {
+		log.Printf("Error saving grant: %v", err)
+		sendMessageHandler(bot, chatID, "Не удалось сохранить права, попробуйте позже")
+		return
+	}
+
+	sendMessageHandler(bot, chatID, fmt.Sprintf("Роль %s выдана: %s %d", grant.Role, subject, id))
+}
+
+// Отзывает роль, выданную командой /grant: /revoke [user|chat] <id>
+func revokeHandler(bot *tgbotapi.BotAPI, message *tgbotapi.Message, crawlerAppConfig appconfig.AppConfig) {
+	chatID := message.Chat.ID
+
+	subject, id, rest, err := parseSubject(strings.Fields(strings.ToLower(message.CommandArguments())))
+	if err != nil || len(rest) != 0 {
+		sendMessageHandler(bot, chatID, "Использование: /revoke [user|chat] <id>")
+		return
+	}
+
+	existed, err := eventStore.DeleteGrant(subject, id)
+	if err != nil {
+		log.Printf("Error deleting grant: %v", err)
+		sendMessageHandler(bot, chatID, "Не удалось отозвать права, попробуйте позже")
+		return
+	}
+	if !existed {
+		sendMessageHandler(bot, chatID, fmt.Sprintf("У %s %d нет выданных через бота прав", subject, id))
+		return
+	}
+
+	text := fmt.Sprintf("Права отозваны: %s %d", subject, id)
+	for _, entry := range crawlerAppConfig.Access {
+		if (subject == storage.SubjectUser && entry.UserID == id) || (subject == storage.SubjectChat && entry.ChatID == id) {
+			text += fmt.Sprintf(". Роль %s из файла конфигурации продолжает действовать", entry.Role)
+		}
+	}
+	sendMessageHandler(bot, chatID, text)
+}
+
+// Показывает список всех, у кого есть доступ к боту
+func accessListHandler(bot *tgbotapi.BotAPI, chatID int64, crawlerAppConfig appconfig.AppConfig) {
+	var lines []string
+	for _, entry := range crawlerAppConfig.Access {
+		if entry.UserID != 0 {
+			lines = append(lines, fmt.Sprintf("user %d — %s (конфигурация)", entry.UserID, entry.Role))
+		} else {
+			lines = append(lines, fmt.Sprintf("chat %d — %s (конфигурация)", entry.ChatID, entry.Role))
+		}
+	}
+
+	grants, err := eventStore.Grants()
+	if err != nil {
+		log.Printf("Error loading grants: %v", err)
+		sendMessageHandler(bot, chatID, "Не удалось загрузить список прав, попробуйте позже")
+		return
+	}
+	for _, grant := range grants {
+		lines = append(lines, fmt.Sprintf("%s %d — %s (выдано %s)", grant.Subject, grant.ID, grant.Role, grant.GrantedAt.Format("02.01.2006")))
+	}
+
+	if len(lines) == 0 {
+		sendMessageHandler(bot, chatID, "Доступ никому не выдан")
+		return
+	}
+	sort.Strings(lines)
+	sendMessageHandler(bot, chatID, "Доступ к боту:\n"+strings.Join(lines, "\n"))
+}
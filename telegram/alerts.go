@@ -0,0 +1,74 @@
+package telegram
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/drift"
+)
+
+// Названия полей, которые заполняются селекторами
+var selectorFields = map[string]string{
+	"TitleSelector": "название",
+	"DateSelector":  "дата",
+	"LinkSelector":  "ссылка",
+}
+
+// SendAlerts отправляет предупреждения о поломке селекторов в чат, не запуская бота.
+// Используется запусками из командной строки
+func SendAlerts(token string, chatID int64, alerts []drift.Alert) error {
+	bot, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return fmt.Errorf("error initializing bot entity: %v", err)
+	}
+	sendDriftAlerts(bot, chatID, alerts)
+	return nil
+}
+
+// alertRecipients возвращает чаты для предупреждений: чат из AlertChatID,
+// а если он не задан — личные чаты администраторов
+func alertRecipients(cfg appconfig.AppConfig) []int64 {
+	if cfg.AlertChatID != 0 {
+		return []int64{cfg.AlertChatID}
+	}
+	var recipients []int64
+	for _, entry := range cfg.Access {
+		if entry.Role == appconfig.RoleAdmin && entry.UserID != 0 {
+			recipients = append(recipients, entry.UserID)
+		}
+	}
+	return recipients
+}
+
+// sendDriftAlerts отправляет предупреждения о сайтах, у которых, похоже, поменялась разметка
+func sendDriftAlerts(bot *tgbotapi.BotAPI, chatID int64, alerts []drift.Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	log.Printf("Selector drift detected on %d sites", len(alerts))
+	for _, text := range splitMessage(formatDriftAlerts(alerts), telegramMessageLimit) {
+		sendMessageHandler(bot, chatID, text)
+	}
+}
+
+// formatDriftAlerts форматирует предупреждения, по одному на строку
+func formatDriftAlerts(alerts []drift.Alert) string {
+	var b strings.Builder
+	b.WriteString("⚠️ Похоже, на сайтах изменилась разметка:\n")
+	for _, alert := range alerts {
+		fmt.Fprintf(&b, "\n• %s (%s)\n  ", alert.URL, alert.EventType)
+		if alert.Kind == drift.KindEventCount && alert.Selector == drift.SourceStructured {
+			fmt.Fprintf(&b, "найдено событий %.0f, в среднем за %d запусков %.1f. Проверьте структурированные данные страницы (JSON-LD или microdata)", alert.Current, alert.Runs, alert.Baseline)
+		} else if alert.Kind == drift.KindEventCount {
+			fmt.Fprintf(&b, "найдено событий %.0f, в среднем за %d запусков %.1f. Проверьте %s", alert.Current, alert.Runs, alert.Baseline, alert.Selector)
+		} else {
+			fmt.Fprintf(&b, "поле «%s» заполнено у %.0f%% событий, обычно у %.0f%%. Проверьте %s", selectorFields[alert.Selector], alert.Current*100, alert.Baseline*100, alert.Selector)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -1,12 +1,14 @@
 package telegram
 
 import (
+	"context"
 	"log"
 	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/rx3lixir/crawler/appconfig"
-	"github.com/rx3lixir/crawler/spreadsheets"
+	"github.com/rx3lixir/crawler/output"
+	"github.com/rx3lixir/crawler/storage"
 )
 
 func StartBot(crawlerAppConfig appconfig.AppConfig) {
@@ -18,6 +20,27 @@ func StartBot(crawlerAppConfig appconfig.AppConfig) {
 
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
+	// Открываем локальное хранилище истории запусков
+	eventStore, err = storage.Open(crawlerAppConfig.StorePath)
+	if err != nil {
+		log.Fatalf("Error opening store: %v", err)
+	}
+	defer eventStore.Close()
+
+	// Проверяем настройки получателей результатов поиска
+	if _, err := output.NewSinks(crawlerAppConfig); err != nil {
+		log.Fatalf("Error creating sinks: %v", err)
+	}
+
+	if len(crawlerAppConfig.Access) == 0 {
+		log.Println("Warning: no access entries configured, set ADMIN_IDS or access in the config file to use bot commands")
+	}
+
+	// Запускаем планировщик регулярных поисков
+	if err := startScheduler(context.Background(), bot, crawlerAppConfig); err != nil {
+		log.Fatalf("Error starting scheduler: %v", err)
+	}
+
 	// Счетчик для ожидания апдейта
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
@@ -26,6 +49,12 @@ func StartBot(crawlerAppConfig appconfig.AppConfig) {
 
 	// Обрабатываем апдейты приходящие из телеграма
 	for update := range updates {
+		// Нажатия на кнопки подтверждения
+		if update.CallbackQuery != nil {
+			handleCallbackQuery(bot, update.CallbackQuery, crawlerAppConfig)
+			continue
+		}
+
 		if update.Message == nil {
 			continue
 		}
@@ -44,29 +73,53 @@ func handleCommands(bot *tgbotapi.BotAPI, update *tgbotapi.Update, crawlerAppCon
 	// Обработка отправленного файла
 	if update.Message.Document != nil {
 		log.Println("Document received")
+		if !authorize(bot, update.Message, crawlerAppConfig, uploadRole) {
+			return
+		}
 		handleFileUpload(bot, update)
 		return
 	}
 
 	chatId := update.Message.Chat.ID
 
+	// Проверяем права на выполнение команды
+	if !authorize(bot, update.Message, crawlerAppConfig, commandRoles[command]) {
+		return
+	}
+
 	switch command {
 	case "start":
-		sendMessageHandler(bot, chatId, "Добро Пожаловать! Перед началом рекомендую сбросить текущие конфигурации с помощью /reset и очистить таблицу с помощью /clear. Запустите /config чтобы задать конфигурацию и /run чтобы запустить поиск!")
+		sendMessageHandler(bot, chatId, "Добро Пожаловать! Перед началом рекомендую сбросить текущие конфигурации с помощью /reset и очистить таблицу с помощью /clear. Запустите /config чтобы задать конфигурацию, /test чтобы проверить селекторы одного сайта и /run чтобы запустить поиск! Своя таблица для результатов задается командой /sheet")
 	case "run":
-		sendMessageHandler(bot, chatId, "Запускаю веб-скраппинг! Пожалуйста подождите, обычно это занимает не более 2 минут")
 		runWebScraperHandler(bot, update.Message.Chat.ID, crawlerAppConfig)
+	case "cancel":
+		cancelRunHandler(bot, chatId)
+	case "status":
+		statusHandler(bot, chatId)
 	case "config":
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Пожалуйста, отправьте файл с конфигурациями. Проверьте чтобы он файл был в формате .json")
 		msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
 		bot.Send(msg)
 	case "reset":
-		resetConfigHandler()
-		sendMessageHandler(bot, chatId, "Конфигурации успешно сброшены! Нажмите /config чтобы задать новые!")
+		requestConfirmation(bot, update.Message, commandRoles[command], "Сбросить конфигурации этого чата?", func() {
+			resetConfigHandler(bot, chatId)
+		})
+	case "test":
+		testSiteHandler(bot, chatId, update.Message.CommandArguments(), crawlerAppConfig)
+	case "sheet":
+		setSpreadsheetHandler(bot, chatId, update.Message.CommandArguments())
+	case "schedule":
+		scheduleHandler(bot, update.Message)
+	case "grant":
+		grantHandler(bot, update.Message)
+	case "revoke":
+		revokeHandler(bot, update.Message, crawlerAppConfig)
+	case "access":
+		accessListHandler(bot, chatId, crawlerAppConfig)
 	case "clear":
-		sendMessageHandler(bot, chatId, "Очищаю таблицу...")
-		spreadsheets.ClearAllSheets(crawlerAppConfig)
-		sendMessageHandler(bot, chatId, "Листы в таблице очищены! Пора что-нибудь найти и скорее их заполнить!")
+		requestConfirmation(bot, update.Message, commandRoles[command], "Очистить все листы таблицы? Это действие нельзя отменить", func() {
+			clearSheetsHandler(bot, chatId, crawlerAppConfig)
+		})
 	default:
 		sendMessageHandler(bot, chatId, "Что-то пошло не так... Может не верно ввели команду?")
 	}
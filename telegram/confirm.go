@@ -0,0 +1,149 @@
+package telegram
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+// Сколько времени ждем подтверждения опасной команды
+const confirmationTimeout = time.Minute
+
+// Префиксы данных кнопок подтверждения
+const (
+	confirmPrefix = "confirm:"
+	declinePrefix = "decline:"
+)
+
+// pendingConfirmation — команда, ожидающая подтверждения от пользователя
+type pendingConfirmation struct {
+	chatID    int64
+	userID    int64
+	messageID int
+	role      string
+	expiresAt time.Time
+	action    func()
+}
+
+var confirmations = struct {
+	sync.Mutex
+	byToken map[string]*pendingConfirmation
+}{byToken: make(map[string]*pendingConfirmation)}
+
+// requestConfirmation спрашивает пользователя, выполнять ли команду, и запоминает действие.
+// Действие выполнится в отдельной горутине только после нажатия "Подтвердить"
+// тем же пользователем до истечения тайм-аута
+func requestConfirmation(bot *tgbotapi.BotAPI, message *tgbotapi.Message, role, question string, action func()) {
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, question)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Подтвердить", confirmPrefix+token),
+			tgbotapi.NewInlineKeyboardButtonData("Отмена", declinePrefix+token),
+		),
+	)
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.Printf("Error sending confirmation: %v", err)
+		return
+	}
+
+	pending := &pendingConfirmation{
+		chatID:    message.Chat.ID,
+		messageID: sent.MessageID,
+		role:      role,
+		expiresAt: time.Now().Add(confirmationTimeout),
+		action:    action,
+	}
+	if message.From != nil {
+		pending.userID = message.From.ID
+	}
+
+	confirmations.Lock()
+	removeExpiredConfirmations()
+	confirmations.byToken[token] = pending
+	confirmations.Unlock()
+}
+
+// removeExpiredConfirmations удаляет просроченные запросы. Вызывается под блокировкой
+func removeExpiredConfirmations() {
+	for token, pending := range confirmations.byToken {
+		if time.Now().After(pending.expiresAt) {
+			delete(confirmations.byToken, token)
+		}
+	}
+}
+
+// handleCallbackQuery обрабатывает нажатия на кнопки подтверждения
+func handleCallbackQuery(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, crawlerAppConfig appconfig.AppConfig) {
+	var token string
+	confirmed := false
+	switch {
+	case strings.HasPrefix(query.Data, confirmPrefix):
+		token = strings.TrimPrefix(query.Data, confirmPrefix)
+		confirmed = true
+	case strings.HasPrefix(query.Data, declinePrefix):
+		token = strings.TrimPrefix(query.Data, declinePrefix)
+	default:
+		answerCallback(bot, query, "")
+		return
+	}
+
+	confirmations.Lock()
+	pending, ok := confirmations.byToken[token]
+	if ok && query.From != nil && query.From.ID == pending.userID {
+		delete(confirmations.byToken, token)
+	}
+	confirmations.Unlock()
+
+	if !ok {
+		answerCallback(bot, query, "Запрос устарел, повторите команду")
+		return
+	}
+	if query.From == nil || query.From.ID != pending.userID {
+		answerCallback(bot, query, "Подтвердить может только автор команды")
+		return
+	}
+
+	approved := false
+	var text string
+	switch {
+	case time.Now().After(pending.expiresAt):
+		text = "Время на подтверждение истекло, повторите команду"
+	case !confirmed:
+		text = "Команда отменена"
+	case roleLevels[roleOf(crawlerAppConfig, pending.userID, pending.chatID)] < roleLevels[pending.role]:
+		text = "Недостаточно прав"
+	default:
+		text = "Подтверждено"
+		approved = true
+	}
+
+	answerCallback(bot, query, text)
+
+	// Убираем кнопки, чтобы запрос нельзя было подтвердить повторно
+	edit := tgbotapi.NewEditMessageText(pending.chatID, pending.messageID, text)
+	if _, err := bot.Send(edit); err != nil {
+		log.Printf("Error updating confirmation message: %v", err)
+	}
+
+	// Действие, например очистка таблицы, может идти минутами, а цикл обновлений
+	// не должен ждать его, как и поиск. О результате действие сообщает в чат само
+	if approved {
+		go pending.action()
+	}
+}
+
+// answerCallback убирает индикатор загрузки с кнопки и показывает короткое уведомление
+func answerCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, text string) {
+	if _, err := bot.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Printf("Error answering callback: %v", err)
+	}
+}
@@ -1,16 +1,22 @@
 package telegram
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/storage"
 )
 
+// Клиент для скачивания файлов конфигурации, чтобы зависший запрос не блокировал бота
+var fileClient = &http.Client{Timeout: 30 * time.Second}
+
 func handleFileUpload(bot *tgbotapi.BotAPI, update *tgbotapi.Update) {
 	log.Println("Handling file upload")
 
@@ -52,7 +58,11 @@ func handleFileUpload(bot *tgbotapi.BotAPI, update *tgbotapi.Update) {
 	fileURL := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, fileInfo.FilePath)
 	log.Printf("File URL: %s", fileURL)
 
-	resp, err := http.Get(fileURL)
+	resp, err := fileClient.Get(fileURL)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
 	if err != nil {
 		log.Printf("Error downloading file: %v", err)
 		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка скачивания файла, повторите попытку позднее")
@@ -72,17 +82,43 @@ func handleFileUpload(bot *tgbotapi.BotAPI, update *tgbotapi.Update) {
 		return
 	}
 
-	// Разбираем JSON-файл на структуры appconfig.SiteConfig
-	err = json.Unmarshal(fileBytes, &userConfigs)
+	// Разбираем и проверяем JSON-файл с конфигурациями appconfig.SiteConfig
+	siteConfigs, err := appconfig.ParseSiteConfigs(fileBytes)
 	if err != nil {
-		log.Printf("Error unmarshalling JSON: %v", err)
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка разбора файла конфигурации, проверьте ошибки синтаксиса внутри файла")
+		log.Printf("Invalid site configs: %v", err)
+		text := "Конфигурации не сохранены, в файле есть ошибки:\n" + formatValidationErrors(err) + "\nИсправьте файл и отправьте его снова"
+		for _, text := range splitMessage(text, telegramMessageLimit) {
+			sendMessageHandler(bot, update.Message.Chat.ID, text)
+		}
+		return
+	}
+
+	// Сохраняем конфигурации в сессию чата, чтобы они пережили перезапуск бота
+	if _, err := eventStore.UpdateSession(update.Message.Chat.ID, func(session *storage.Session) {
+		session.SiteConfigs = siteConfigs
+	}); err != nil {
+		log.Printf("Error saving session: %v", err)
+		msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка сохранения конфигураций, попробуйте позже")
 		bot.Send(msg)
 		return
 	}
 
 	log.Println("Configurations successfully loaded")
 
-	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Конфигурации успешно загружены! Запустите поиск с помощью /run")
+	msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Конфигурации успешно загружены (%d)! Запустите поиск с помощью /run", len(siteConfigs)))
 	bot.Send(msg)
 }
+
+// formatValidationErrors перечисляет ошибки конфигурации, каждую с номером сайта и полем
+func formatValidationErrors(err error) string {
+	var errs appconfig.ValidationErrors
+	if !errors.As(err, &errs) {
+		return "• " + err.Error() + "\n"
+	}
+
+	var b strings.Builder
+	for _, fieldErr := range errs {
+		b.WriteString("• " + fieldErr.Error() + "\n")
+	}
+	return b.String()
+}
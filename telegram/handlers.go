@@ -1,17 +1,29 @@
 package telegram
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"regexp"
+	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/output"
 	"github.com/rx3lixir/crawler/spreadsheets"
-	"github.com/rx3lixir/crawler/web"
+	"github.com/rx3lixir/crawler/storage"
 )
 
-// Переменная для хранения пользовательских конфигураций для поиска
-var userConfigs []appconfig.SiteConfig
+// Время на очистку таблицы
+const clearTimeout = 2 * time.Minute
+
+// Хранилище истории запусков, найденных событий и настроек чатов
+var eventStore *storage.Store
+
+// Ссылка на таблицу Google Sheets или её идентификатор целиком, без лишнего текста
+var spreadsheetIDPattern = regexp.MustCompile(`^(?:https?://docs\.google\.com/spreadsheets/d/([a-zA-Z0-9_-]{20,})(?:[/?#]\S*)?|([a-zA-Z0-9_-]{20,}))$`)
 
 // Отправляет пользователю сообщение в tg
 func sendMessageHandler(bot *tgbotapi.BotAPI, chatID int64, text string) {
@@ -21,25 +33,115 @@ func sendMessageHandler(bot *tgbotapi.BotAPI, chatID int64, text string) {
 	}
 }
 
-// Сбрасывает конфигурационный файл
-func resetConfigHandler() {
-	// Обновляем глобальную переменную userConfigs
-	userConfigs = nil
+// Сбрасывает конфигурации чата
+func resetConfigHandler(bot *tgbotapi.BotAPI, chatID int64) {
+	if _, err := eventStore.UpdateSession(chatID, func(session *storage.Session) {
+		session.SiteConfigs = nil
+	}); err != nil {
+		log.Printf("Error resetting configs: %v", err)
+		sendMessageHandler(bot, chatID, "Не удалось сбросить конфигурации, попробуйте позже")
+		return
+	}
+	sendMessageHandler(bot, chatID, "Конфигурации успешно сброшены! Нажмите /config чтобы задать новые!")
+}
+
+// Очищает все листы таблицы чата
+func clearSheetsHandler(bot *tgbotapi.BotAPI, chatID int64, crawlerAppConfig appconfig.AppConfig) {
+	sendMessageHandler(bot, chatID, "Очищаю таблицу...")
+	session, err := eventStore.Session(chatID)
+	if err != nil {
+		log.Printf("Error loading session: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clearTimeout)
+	defer cancel()
+	if err := spreadsheets.ClearAllSheets(ctx, chatAppConfig(crawlerAppConfig, session)); err != nil {
+		log.Printf("Error clearing sheets: %v", err)
+		sendMessageHandler(bot, chatID, "Не удалось очистить таблицу: "+err.Error())
+		return
+	}
+	sendMessageHandler(bot, chatID, "Листы в таблице очищены! Пора что-нибудь найти и скорее их заполнить!")
+}
+
+// Сохраняет таблицу, в которую пишутся результаты чата
+func setSpreadsheetHandler(bot *tgbotapi.BotAPI, chatID int64, args string) {
+	match := spreadsheetIDPattern.FindStringSubmatch(strings.TrimSpace(args))
+	if match == nil {
+		sendMessageHandler(bot, chatID, "Укажите ссылку на таблицу или её идентификатор, например: /sheet https://docs.google.com/spreadsheets/d/<id>/edit")
+		return
+	}
+
+	if _, err := eventStore.UpdateSession(chatID, func(session *storage.Session) {
+		// Совпадает только одна из групп: ссылка или голый идентификатор
+		session.SpreadsheetID = match[1] + match[2]
+	}); err != nil {
+		log.Printf("Error saving session: %v", err)
+		sendMessageHandler(bot, chatID, "Не удалось сохранить таблицу, попробуйте позже")
+		return
+	}
+
+	sendMessageHandler(bot, chatID, "Таблица сохранена! Результаты этого чата будут записываться в неё")
 }
 
-// Запускает веб-скраппинг применяя конфигурацию
+// Возвращает конфигурацию приложения с учетом настроек чата
+func chatAppConfig(crawlerAppConfig appconfig.AppConfig, session storage.Session) appconfig.AppConfig {
+	if session.SpreadsheetID != "" {
+		crawlerAppConfig.SpreadsheetID = session.SpreadsheetID
+	}
+	return crawlerAppConfig
+}
+
+// Запускает веб-скраппинг в фоне применяя конфигурацию чата
 func runWebScraperHandler(bot *tgbotapi.BotAPI, chatID int64, crawlerAppConfig appconfig.AppConfig) {
-	var siteConfigs []appconfig.SiteConfig
+	if _, err := startRun(bot, chatID, crawlerAppConfig); err != nil {
+		sendMessageHandler(bot, chatID, err.Error())
+	}
+}
 
-	if len(userConfigs) > 0 {
-		siteConfigs = userConfigs
-	} else {
-		sendMessageHandler(bot, chatID, "Конфигурация не задана. Запустите /config чтобы добавить файл конфигурации")
+// Останавливает текущий поиск в чате
+func cancelRunHandler(bot *tgbotapi.BotAPI, chatID int64) {
+	if !activeRuns.cancel(chatID) {
+		sendMessageHandler(bot, chatID, "Сейчас ничего не ищется")
 		return
 	}
+	sendMessageHandler(bot, chatID, "Останавливаю поиск...")
+}
 
-	allEvents := web.WebScraper(siteConfigs)
-	spreadsheets.WriteToSpreadsheet(allEvents, *&crawlerAppConfig)
+// Показывает состояние текущего или последнего поиска
+func statusHandler(bot *tgbotapi.BotAPI, chatID int64) {
+	if run := activeRuns.get(chatID); run != nil {
+		sendMessageHandler(bot, chatID, run.progressText())
+		return
+	}
 
-	sendMessageHandler(bot, chatID, "Ищейкин сделал дело. Проверьте результат по ссылке: https://docs.google.com/spreadsheets/d/1G8eLUjCeqBZ9dqQJiWxJ3GfjBS9Oqd4_lLnaRMsCbYo/edit#gid=0")
+	session, err := eventStore.Session(chatID)
+	if err != nil {
+		log.Printf("Error loading session: %v", err)
+		sendMessageHandler(bot, chatID, "Не удалось загрузить настройки чата, попробуйте позже")
+		return
+	}
+	if session.LastRunID == 0 {
+		sendMessageHandler(bot, chatID, "Поиск еще не запускался. Запустите /run")
+		return
+	}
+	text := fmt.Sprintf("Сейчас ничего не ищется. Последний поиск #%d завершился %s", session.LastRunID, session.LastRunAt.Format("02.01.2006 15:04"))
+	run, found, err := eventStore.Run(session.LastRunID)
+	if err != nil {
+		log.Printf("Error loading run %d: %v", session.LastRunID, err)
+	}
+	if found && len(run.Reports) > 0 {
+		text += "\n\n" + formatRunReport(run.Reports)
+	}
+	for _, part := range splitMessage(text, telegramMessageLimit) {
+		sendMessageHandler(bot, chatID, part)
+	}
+}
+
+// Возвращает подсказку, где искать результаты, если они пишутся в Google Sheets
+func resultsLocation(sinks []output.Sink, crawlerAppConfig appconfig.AppConfig) string {
+	for _, sink := range sinks {
+		if sink.Name() == appconfig.SinkSheets {
+			return fmt.Sprintf(" Проверьте результат по ссылке: https://docs.google.com/spreadsheets/d/%s/edit#gid=0", crawlerAppConfig.SpreadsheetID)
+		}
+	}
+	return ""
 }
@@ -0,0 +1,96 @@
+package telegram
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/storage"
+)
+
+// Максимальная длина текста одного сообщения в Telegram
+const telegramMessageLimit = 4096
+
+// sendDiffSummary отправляет сводку изменений по сравнению с прошлым запуском
+func sendDiffSummary(bot *tgbotapi.BotAPI, chatID int64, diff storage.Diff) {
+	for _, text := range splitMessage(formatDiffSummary(diff), telegramMessageLimit) {
+		sendMessageHandler(bot, chatID, text)
+	}
+}
+
+// formatDiffSummary собирает текст сводки: новые события сгруппированы по типу
+func formatDiffSummary(diff storage.Diff) string {
+	if diff.IsEmpty() {
+		return "С прошлого запуска ничего не изменилось"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Новых событий: %d, изменилось: %d, пропало: %d\n", len(diff.Added), len(diff.Changed), len(diff.Removed))
+
+	// Группируем новые события по типу
+	byType := make(map[string][]appconfig.EventConfig)
+	for _, event := range diff.Added {
+		byType[event.EventType] = append(byType[event.EventType], event)
+	}
+
+	eventTypes := make([]string, 0, len(byType))
+	for eventType := range byType {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	for _, eventType := range eventTypes {
+		fmt.Fprintf(&b, "\n%s (%d):\n", eventType, len(byType[eventType]))
+		for _, event := range byType[eventType] {
+			b.WriteString(formatEventLine(event))
+		}
+	}
+
+	return b.String()
+}
+
+// formatEventLine форматирует одно событие для сообщения
+func formatEventLine(event appconfig.EventConfig) string {
+	line := "• " + event.Title
+	if event.Date != "" {
+		line += " — " + event.Date
+	}
+	if event.Link != "" {
+		line += "\n  " + event.Link
+	}
+	return line + "\n"
+}
+
+// splitMessage разбивает текст на части не длиннее limit символов, по возможности по строкам
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	var current strings.Builder
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		// Слишком длинную строку режем на куски
+		for utf8.RuneCountInString(line) > limit {
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+			runes := []rune(line)
+			parts = append(parts, string(runes[:limit]))
+			line = string(runes[limit:])
+		}
+
+		if utf8.RuneCountInString(current.String())+utf8.RuneCountInString(line) > limit {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+
+	if strings.TrimSpace(current.String()) != "" {
+		parts = append(parts, current.String())
+	}
+
+	return parts
+}
@@ -0,0 +1,92 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+// Сколько символов ошибки показывать в отчете
+const reportErrorLimit = 200
+
+// Названия причин ошибок для пользователя
+var errorKindNames = map[appconfig.ErrorKind]string{
+	appconfig.ErrorNetwork:       "сетевая ошибка",
+	appconfig.ErrorHTTPStatus:    "сайт ответил ошибкой",
+	appconfig.ErrorRenderTimeout: "страница не загрузилась вовремя",
+	appconfig.ErrorNoMatch:       "селекторы ничего не нашли",
+	appconfig.ErrorParse:         "ошибка разбора страницы",
+	appconfig.ErrorConfig:        "ошибка конфигурации",
+	appconfig.ErrorCancelled:     "поиск остановлен",
+	appconfig.ErrorTimeout:       "не уложился в отведенное время",
+	appconfig.ErrorDisallowed:    "запрещено robots.txt",
+	appconfig.ErrorUnknown:       "неизвестная ошибка",
+}
+
+// Значки статусов сайтов
+var statusIcons = map[appconfig.SiteStatus]string{
+	appconfig.SiteOK:        "✅",
+	appconfig.SiteEmpty:     "⚠️",
+	appconfig.SitePartial:   "🟡",
+	appconfig.SiteFailed:    "❌",
+	appconfig.SiteCancelled: "⏹",
+	appconfig.SiteSkipped:   "🚫",
+}
+
+// failedSites возвращает число сайтов, которые не удалось обработать целиком
+func failedSites(reports []appconfig.SiteReport) int {
+	failed := 0
+	for _, report := range reports {
+		if hasFailed(report) {
+			failed++
+		}
+	}
+	return failed
+}
+
+// hasFailed сообщает, что сайт не удалось обработать или обработать полностью
+func hasFailed(report appconfig.SiteReport) bool {
+	return report.Status == appconfig.SiteFailed || report.Status == appconfig.SitePartial
+}
+
+// formatRunReport форматирует отчет о поиске: по строке на каждый сайт
+func formatRunReport(reports []appconfig.SiteReport) string {
+	if len(reports) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Отчет по сайтам:\n")
+	for _, report := range reports {
+		fmt.Fprintf(&b, "%s %s — событий %d", statusIcons[report.Status], report.URL, report.Events)
+		if report.Rejected > 0 {
+			fmt.Fprintf(&b, ", отброшено %d", report.Rejected)
+		}
+		if report.Disallowed > 0 {
+			fmt.Fprintf(&b, ", пропущено по robots.txt %d", report.Disallowed)
+		}
+		if report.Pages > 1 {
+			fmt.Fprintf(&b, ", страниц %d", report.Pages)
+		}
+		if report.Retries > 0 {
+			fmt.Fprintf(&b, ", повторов %d", report.Retries)
+		}
+		fmt.Fprintf(&b, ", %s", report.Duration.Round(100*time.Millisecond))
+		if report.ErrorKind != "" && report.ErrorKind != appconfig.ErrorCancelled {
+			fmt.Fprintf(&b, "\n   %s: %s", errorKindNames[report.ErrorKind], truncate(report.Error, reportErrorLimit))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// truncate обрезает строку до limit символов
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,285 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/output"
+	"github.com/rx3lixir/crawler/pipeline"
+	"github.com/rx3lixir/crawler/storage"
+	"github.com/rx3lixir/crawler/web"
+)
+
+// Как часто можно редактировать сообщение с прогрессом, чтобы не упереться в лимиты Telegram
+const progressEditInterval = 2 * time.Second
+
+// activeRun описывает поиск, который сейчас выполняется в чате
+type activeRun struct {
+	ID        string
+	ChatID    int64
+	StartedAt time.Time
+	cancelRun context.CancelFunc
+
+	mu        sync.Mutex
+	messageID int
+	lastEdit  time.Time
+	total     int
+	done      int
+	failed    int
+	events    int
+	cancelled bool
+}
+
+// siteDone учитывает завершение очередного сайта
+func (r *activeRun) siteDone(report appconfig.SiteReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.done++
+	r.events += report.Events
+	if hasFailed(report) {
+		r.failed++
+	}
+}
+
+// progressText возвращает текст сообщения о ходе поиска
+func (r *activeRun) progressText() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	text := fmt.Sprintf("Поиск %s: обработано сайтов %d из %d, с ошибками %d, найдено событий %d", r.ID, r.done, r.total, r.failed, r.events)
+	if r.cancelled {
+		return text + "\nПоиск останавливается..."
+	}
+	return text + "\n/cancel — остановить, /status — состояние"
+}
+
+// summaryText возвращает итоговый текст сообщения о поиске
+func (r *activeRun) summaryText() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := "завершен"
+	if r.cancelled {
+		state = "остановлен"
+	}
+	return fmt.Sprintf("Поиск %s %s: обработано сайтов %d из %d, с ошибками %d, найдено событий %d", r.ID, state, r.done, r.total, r.failed, r.events)
+}
+
+// runRegistry хранит поиски, выполняющиеся в чатах. В каждом чате одновременно идет не больше одного поиска
+type runRegistry struct {
+	mu     sync.Mutex
+	byChat map[int64]*activeRun
+}
+
+var activeRuns = &runRegistry{byChat: make(map[int64]*activeRun)}
+
+// start регистрирует новый поиск, если в чате сейчас ничего не ищется
+func (r *runRegistry) start(chatID int64, total int, cancel context.CancelFunc) (*activeRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, busy := r.byChat[chatID]; busy {
+		return nil, false
+	}
+
+	run := &activeRun{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		ChatID:    chatID,
+		StartedAt: time.Now(),
+		cancelRun: cancel,
+		total:     total,
+	}
+	r.byChat[chatID] = run
+	return run, true
+}
+
+// get возвращает текущий поиск чата или nil
+func (r *runRegistry) get(chatID int64) *activeRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.byChat[chatID]
+}
+
+// cancel останавливает текущий поиск чата
+func (r *runRegistry) cancel(chatID int64) bool {
+	r.mu.Lock()
+	run, ok := r.byChat[chatID]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	run.mu.Lock()
+	run.cancelled = true
+	run.mu.Unlock()
+
+	run.cancelRun()
+	return true
+}
+
+// finish убирает поиск из списка текущих
+func (r *runRegistry) finish(run *activeRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byChat[run.ChatID] == run {
+		delete(r.byChat, run.ChatID)
+	}
+	run.cancelRun()
+}
+
+// startRun проверяет настройки чата и запускает поиск в фоне.
+// Канал done закрывается, когда поиск завершен. Возвращаемая ошибка предназначена для показа пользователю
+func startRun(bot *tgbotapi.BotAPI, chatID int64, crawlerAppConfig appconfig.AppConfig) (<-chan struct{}, error) {
+	session, err := eventStore.Session(chatID)
+	if err != nil {
+		log.Printf("Error loading session: %v", err)
+		return nil, errors.New("Не удалось загрузить настройки чата, попробуйте позже")
+	}
+
+	siteConfigs := session.SiteConfigs
+	if len(siteConfigs) == 0 {
+		return nil, errors.New("Конфигурация не задана. Запустите /config чтобы добавить файл конфигурации")
+	}
+
+	crawlerAppConfig = chatAppConfig(crawlerAppConfig, session)
+	sinks, err := output.NewSinks(crawlerAppConfig)
+	if err != nil {
+		log.Printf("Error creating sinks: %v", err)
+		return nil, errors.New("Ошибка настройки вывода результатов: " + err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run, ok := activeRuns.start(chatID, len(siteConfigs), cancel)
+	if !ok {
+		cancel()
+		return nil, errors.New("Поиск уже идет. /status покажет его состояние, /cancel остановит")
+	}
+
+	// Сообщение с прогрессом, которое будет обновляться по мере обработки сайтов
+	msg, err := bot.Send(tgbotapi.NewMessage(chatID, run.progressText()))
+	if err != nil {
+		log.Printf("Error sending message: %v", err)
+	}
+	run.messageID = msg.MessageID
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		executeRun(ctx, bot, run, crawlerAppConfig, siteConfigs, sinks)
+	}()
+	return done, nil
+}
+
+// executeRun выполняет поиск, сохраняет результаты и сообщает о них в чат
+func executeRun(ctx context.Context, bot *tgbotapi.BotAPI, active *activeRun, crawlerAppConfig appconfig.AppConfig, siteConfigs []appconfig.SiteConfig, sinks []output.Sink) {
+	defer activeRuns.finish(active)
+	chatID := active.ChatID
+
+	location, err := crawlerAppConfig.Location()
+	if err != nil {
+		log.Printf("Error loading timezone: %v", err)
+	}
+
+	opts := web.Options{
+		Location:    location,
+		RateLimit:   crawlerAppConfig.RateLimit,
+		UserAgent:   crawlerAppConfig.UserAgent,
+		Retry:       crawlerAppConfig.Retry,
+		SiteTimeout: time.Duration(crawlerAppConfig.SiteTimeoutSeconds) * time.Second,
+		RunTimeout:  time.Duration(crawlerAppConfig.RunTimeoutSeconds) * time.Second,
+		OnSiteDone: func(config appconfig.SiteConfig, report appconfig.SiteReport) {
+			active.siteDone(report)
+			updateProgress(bot, active, false)
+		},
+	}
+	result, err := pipeline.Execute(ctx, pipeline.Request{
+		Sites:   siteConfigs,
+		ChatID:  chatID,
+		Store:   eventStore,
+		Sinks:   sinks,
+		Options: opts,
+		Drift:   crawlerAppConfig.Drift,
+	})
+	updateProgress(bot, active, true)
+
+	if err != nil {
+		sendMessageHandler(bot, chatID, fmt.Sprintf("Поиск %s остановлен, результаты не сохранены", active.ID))
+		return
+	}
+
+	run := result.Run
+	if run.ID != 0 {
+		if _, err := eventStore.UpdateSession(chatID, func(session *storage.Session) {
+			session.LastRunID = run.ID
+			session.LastRunAt = run.FinishedAt
+		}); err != nil {
+			log.Printf("Error saving session: %v", err)
+		}
+	}
+
+	if result.WriteErr != nil {
+		log.Printf("Error writing results: %v", result.WriteErr)
+		sendMessageHandler(bot, chatID, "Не удалось сохранить часть результатов: "+result.WriteErr.Error())
+	}
+
+	done := "Ищейкин сделал дело."
+	if failedSites(run.Reports) > 0 {
+		done = "Ищейкин сделал дело, но не со всеми сайтами."
+	}
+	sendMessageHandler(bot, chatID, done+resultsLocation(sinks, crawlerAppConfig))
+	for _, text := range splitMessage(formatRunReport(run.Reports), telegramMessageLimit) {
+		sendMessageHandler(bot, chatID, text)
+	}
+
+	// Предупреждения о поломке селекторов уходят администраторам, а не в чат запуска
+	if len(result.Alerts) > 0 {
+		recipients := alertRecipients(crawlerAppConfig)
+		if len(recipients) == 0 {
+			log.Printf("Selector drift detected on %d sites, but neither an alert chat nor admins are configured", len(result.Alerts))
+		}
+		for _, recipient := range recipients {
+			sendDriftAlerts(bot, recipient, result.Alerts)
+		}
+	}
+
+	// Сообщаем, что нового появилось с прошлого запуска
+	if run.ID != 0 {
+		diff, err := eventStore.DiffWithPrevious(run.ID)
+		if err != nil {
+			log.Printf("Error computing diff: %v", err)
+			return
+		}
+		sendDiffSummary(bot, chatID, diff)
+	}
+}
+
+// updateProgress редактирует сообщение с прогрессом не чаще progressEditInterval.
+// Итоговое обновление отправляется всегда
+func updateProgress(bot *tgbotapi.BotAPI, run *activeRun, final bool) {
+	run.mu.Lock()
+	if run.messageID == 0 || (!final && time.Since(run.lastEdit) < progressEditInterval) {
+		run.mu.Unlock()
+		return
+	}
+	run.lastEdit = time.Now()
+	run.mu.Unlock()
+
+	text := run.progressText()
+	if final {
+		text = run.summaryText()
+	}
+
+	edit := tgbotapi.NewEditMessageText(run.ChatID, run.messageID, text)
+	if _, err := bot.Send(edit); err != nil {
+		log.Printf("Error updating progress message: %v", err)
+	}
+}
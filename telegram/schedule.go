@@ -0,0 +1,154 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/scheduler"
+	"github.com/rx3lixir/crawler/storage"
+)
+
+// Планировщик регулярных поисков
+var jobScheduler *scheduler.Scheduler
+
+// startScheduler создает планировщик, загружает расписания из конфигурации и хранилища и запускает его
+func startScheduler(ctx context.Context, bot *tgbotapi.BotAPI, crawlerAppConfig appconfig.AppConfig) error {
+	location, err := crawlerAppConfig.Location()
+	if err != nil {
+		return err
+	}
+
+	jobScheduler = scheduler.New(location, func(ctx context.Context, job scheduler.Job) {
+		runScheduledJob(ctx, bot, job, crawlerAppConfig)
+	})
+
+	// Общие расписания из файла конфигурации
+	for i, schedule := range crawlerAppConfig.Schedules {
+		job := scheduler.Job{ID: fmt.Sprintf("g%d", i+1), ChatID: schedule.ChatID, Spec: schedule.Spec, Global: true}
+		if err := jobScheduler.Add(job); err != nil {
+			return fmt.Errorf("schedule %s: %v", job.ID, err)
+		}
+	}
+
+	// Расписания, добавленные из чатов
+	records, err := eventStore.Schedules()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := jobScheduler.Add(scheduleJob(record)); err != nil {
+			log.Printf("Error restoring schedule %d: %v", record.ID, err)
+		}
+	}
+
+	go jobScheduler.Run(ctx)
+	return nil
+}
+
+// scheduleJob превращает сохраненное расписание в задание планировщика
+func scheduleJob(record storage.ScheduleRecord) scheduler.Job {
+	return scheduler.Job{ID: strconv.FormatUint(record.ID, 10), ChatID: record.ChatID, Spec: record.Spec}
+}
+
+// runScheduledJob запускает поиск по расписанию и ждет его завершения
+func runScheduledJob(ctx context.Context, bot *tgbotapi.BotAPI, job scheduler.Job, crawlerAppConfig appconfig.AppConfig) {
+	done, err := startRun(bot, job.ChatID, crawlerAppConfig)
+	if err != nil {
+		log.Printf("Scheduled job %s not started: %v", job.ID, err)
+		sendMessageHandler(bot, job.ChatID, fmt.Sprintf("Поиск по расписанию %s не запущен: %v", job.ID, err))
+		return
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// Управляет расписаниями чата: /schedule add <spec>, /schedule list, /schedule remove <id>
+func scheduleHandler(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	usage := "Использование:\n/schedule add <cron или @every 6h>\n/schedule list\n/schedule remove <id>\n\nПример: /schedule add 0 9 * * 1-5 — по будням в 9:00"
+
+	action, args, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	args = strings.TrimSpace(args)
+
+	switch strings.ToLower(action) {
+	case "add":
+		if args == "" {
+			sendMessageHandler(bot, chatID, usage)
+			return
+		}
+		if _, err := scheduler.Parse(args); err != nil {
+			sendMessageHandler(bot, chatID, "Неверное расписание: "+err.Error())
+			return
+		}
+
+		record := storage.ScheduleRecord{ChatID: chatID, Spec: args, CreatedAt: time.Now()}
+		if message.From != nil {
+			record.CreatedBy = message.From.ID
+		}
+		record, err := eventStore.AddSchedule(record)
+		if err != nil {
+			log.Printf("Error saving schedule: %v", err)
+			sendMessageHandler(bot, chatID, "Не удалось сохранить расписание, попробуйте позже")
+			return
+		}
+		if err := jobScheduler.Add(scheduleJob(record)); err != nil {
+			// Иначе запись вернется в планировщик при следующем запуске
+			if _, deleteErr := eventStore.DeleteSchedule(chatID, record.ID); deleteErr != nil {
+				log.Printf("Error deleting rejected schedule %d: %v", record.ID, deleteErr)
+			}
+			sendMessageHandler(bot, chatID, "Неверное расписание: "+err.Error())
+			return
+		}
+		sendMessageHandler(bot, chatID, fmt.Sprintf("Расписание %d добавлено: %s", record.ID, record.Spec))
+
+	case "list":
+		var lines []string
+		for _, job := range jobScheduler.Jobs() {
+			if job.ChatID != chatID {
+				continue
+			}
+			line := fmt.Sprintf("%s: %s, следующий запуск %s", job.ID, job.Spec, job.Next.Format("02.01.2006 15:04"))
+			if job.Global {
+				line += " (из конфигурации)"
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) == 0 {
+			sendMessageHandler(bot, chatID, "Расписаний нет. Добавьте: /schedule add @every 6h")
+			return
+		}
+		sendMessageHandler(bot, chatID, "Расписания чата:\n"+strings.Join(lines, "\n"))
+
+	case "remove":
+		id, err := strconv.ParseUint(args, 10, 64)
+		if err != nil {
+			sendMessageHandler(bot, chatID, usage)
+			return
+		}
+		existed, err := eventStore.DeleteSchedule(chatID, id)
+		if err != nil {
+			log.Printf("Error deleting schedule: %v", err)
+			sendMessageHandler(bot, chatID, "Не удалось удалить расписание, попробуйте позже")
+			return
+		}
+		if !existed {
+			sendMessageHandler(bot, chatID, fmt.Sprintf("Расписание %d не найдено", id))
+			return
+		}
+		jobScheduler.Remove(strconv.FormatUint(id, 10))
+		sendMessageHandler(bot, chatID, fmt.Sprintf("Расписание %d удалено", id))
+
+	default:
+		sendMessageHandler(bot, chatID, usage)
+	}
+}
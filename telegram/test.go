@@ -0,0 +1,149 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/web"
+)
+
+// Сколько может длиться проверка одного сайта
+const testTimeout = 3 * time.Minute
+
+const testUsage = "Укажите номер сайта из загруженных конфигураций или саму конфигурацию в JSON, например:\n/test 2\n/test {\"UrlToVisit\": \"https://...\", ...}"
+
+// Проверяет конфигурацию одного сайта: скачивает первую страницу и показывает,
+// что из нее извлекается. Ничего не записывает в таблицу и историю
+func testSiteHandler(bot *tgbotapi.BotAPI, chatID int64, args string, crawlerAppConfig appconfig.AppConfig) {
+	config, err := testSiteConfig(chatID, strings.TrimSpace(args))
+	if err != nil {
+		for _, text := range splitMessage(err.Error(), telegramMessageLimit) {
+			sendMessageHandler(bot, chatID, text)
+		}
+		return
+	}
+
+	loc, err := crawlerAppConfig.Location()
+	if err != nil {
+		log.Printf("Error loading timezone: %v", err)
+		sendMessageHandler(bot, chatID, "Не удалось загрузить часовой пояс из настроек")
+		return
+	}
+
+	sendMessageHandler(bot, chatID, "Проверяю "+config.UrlToVisit+"...")
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+
+		opts := web.Options{
+			Location:  loc,
+			RateLimit: crawlerAppConfig.RateLimit,
+			UserAgent: crawlerAppConfig.UserAgent,
+			Retry:     crawlerAppConfig.Retry,
+		}
+		report, err := web.DryRun(ctx, config, opts, web.DefaultSampleSize)
+		if err != nil {
+			log.Printf("Error testing %s: %v", config.UrlToVisit, err)
+			sendMessageHandler(bot, chatID, "Не удалось загрузить страницу: "+err.Error())
+			return
+		}
+
+		for _, text := range splitMessage(formatDryRunReport(report), telegramMessageLimit) {
+			sendMessageHandler(bot, chatID, text)
+		}
+	}()
+}
+
+// testSiteConfig находит конфигурацию для проверки: по номеру среди загруженных в чат
+// или разбирает переданный JSON. Ошибки возвращаются готовыми для отправки пользователю
+func testSiteConfig(chatID int64, args string) (appconfig.SiteConfig, error) {
+	if args == "" {
+		return appconfig.SiteConfig{}, errors.New(testUsage)
+	}
+
+	if number, err := strconv.Atoi(args); err == nil {
+		session, err := eventStore.Session(chatID)
+		if err != nil {
+			log.Printf("Error loading session: %v", err)
+			return appconfig.SiteConfig{}, errors.New("Не удалось загрузить настройки чата, попробуйте позже")
+		}
+		if len(session.SiteConfigs) == 0 {
+			return appconfig.SiteConfig{}, errors.New("Конфигурации не заданы. Запустите /config или передайте конфигурацию в JSON")
+		}
+		if number < 1 || number > len(session.SiteConfigs) {
+			return appconfig.SiteConfig{}, fmt.Errorf("Нет сайта с номером %d, загружено конфигураций: %d", number, len(session.SiteConfigs))
+		}
+		return session.SiteConfigs[number-1], nil
+	}
+
+	configs, err := appconfig.ParseSiteConfigs([]byte(args))
+	if err != nil {
+		return appconfig.SiteConfig{}, fmt.Errorf("В конфигурации есть ошибки:\n%s", formatValidationErrors(err))
+	}
+	if len(configs) != 1 {
+		return appconfig.SiteConfig{}, fmt.Errorf("Передайте одну конфигурацию, а не %d", len(configs))
+	}
+	return configs[0], nil
+}
+
+// formatDryRunReport форматирует результат проверки сайта
+func formatDryRunReport(report web.DryRunReport) string {
+	var b strings.Builder
+	if report.Structured == appconfig.StructuredOnly {
+		fmt.Fprintf(&b, "Проверка %s\nСобытий schema.org: %d\n", report.PageURL, report.Matched)
+		if report.Matched == 0 {
+			b.WriteString("На странице нет событий в JSON-LD или микроразметке\n")
+			return b.String()
+		}
+	} else {
+		fmt.Fprintf(&b, "Проверка %s\nЭлементов по AnchestorSelector: %d\n", report.PageURL, report.Matched)
+		if report.Structured != "" {
+			fmt.Fprintf(&b, "Событий schema.org для дополнения: %d\n", report.StructuredEvents)
+		}
+		if report.Matched == 0 {
+			b.WriteString("Ни один элемент не найден, проверьте AnchestorSelector\n")
+			return b.String()
+		}
+	}
+
+	fmt.Fprintf(&b, "\nПервые события (%d):\n", len(report.Samples))
+	for i, sample := range report.Samples {
+		event := sample.Event
+		fmt.Fprintf(&b, "\n%d. %s\n", i+1, valueOrDash(event.Title))
+		fmt.Fprintf(&b, "   Дата: %s", valueOrDash(event.Date))
+		if !event.Start.IsZero() {
+			fmt.Fprintf(&b, " (%s)", event.Start.Format("02.01.2006 15:04"))
+		} else if event.Date != "" {
+			b.WriteString(" (не удалось разобрать)")
+		}
+		fmt.Fprintf(&b, "\n   Место: %s\n   Ссылка: %s\n", valueOrDash(event.Location), valueOrDash(event.Link))
+		if event.Price != "" {
+			fmt.Fprintf(&b, "   Цена: %s\n", event.Price)
+		}
+		if len(sample.EmptySelectors) > 0 {
+			fmt.Fprintf(&b, "   Ничего не нашли: %s\n", strings.Join(sample.EmptySelectors, ", "))
+		}
+	}
+
+	if report.NextPageURL != "" {
+		fmt.Fprintf(&b, "\nСледующая страница: %s\n", report.NextPageURL)
+	}
+	return b.String()
+}
+
+// valueOrDash заменяет пустое значение прочерком
+func valueOrDash(value string) string {
+	if value == "" {
+		return "—"
+	}
+	return value
+}
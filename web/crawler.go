@@ -1,23 +1,25 @@
 package web
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/dates"
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	maxWorkers = 20
-	maxRetries = 3
+
+	defaultSiteTimeout = 10 * time.Minute
+	defaultRunTimeout  = time.Hour
 )
 
 var log = logrus.New()
@@ -30,148 +32,447 @@ func init() {
 	log.SetLevel(logrus.InfoLevel)
 }
 
+// Options tune a scraping run.
+type Options struct {
+	// Location is the default timezone for event dates
+	Location *time.Location
+	// RateLimit is the default politeness policy per host, SiteConfig.RateLimit overrides it
+	RateLimit appconfig.RateLimit
+	// UserAgent is sent with requests and matched against robots.txt, DefaultUserAgent if empty
+	UserAgent string
+	// Retry is the policy for failed requests, defaults of the retry package if zero
+	Retry appconfig.RetryConfig
+	// SiteTimeout bounds the crawl of one site, SiteConfig.TimeoutSeconds overrides it.
+	// A default applies if zero, negative disables the deadline
+	SiteTimeout time.Duration
+	// RunTimeout bounds the whole crawl, same rules as SiteTimeout
+	RunTimeout time.Duration
+	// OnSiteDone, if set, is called from the collecting goroutine after each site finishes
+	OnSiteDone func(config appconfig.SiteConfig, report appconfig.SiteReport)
+}
+
 type Job struct {
+	index  int
 	config appconfig.SiteConfig
 }
 
 type Result struct {
+	index  int
+	config appconfig.SiteConfig
 	events []appconfig.EventConfig
-	err    error
+	report appconfig.SiteReport
 }
 
-// WebScraper processes site configurations and returns a list of extracted events.
-func WebScraper(allConfigs []appconfig.SiteConfig) []appconfig.EventConfig {
+// siteStats collects counters of a site crawl. Detail pages are fetched
+// concurrently, so retries are counted atomically.
+type siteStats struct {
+	pages           int
+	rejected        int
+	firstPageEvents int
+	retries         int32
+	disallowed      int32
+}
+
+// retried counts a repeated fetch; stats may be nil.
+func (s *siteStats) retried() {
+	if s != nil {
+		atomic.AddInt32(&s.retries, 1)
+	}
+}
+
+// skipped counts a URL disallowed by robots.txt; stats may be nil.
+func (s *siteStats) skipped() {
+	if s != nil {
+		atomic.AddInt32(&s.disallowed, 1)
+	}
+}
+
+// WebScraper processes site configurations and returns the extracted events
+// together with a report for every configuration, in the same order.
+// Cancelling ctx stops pending fetches; events found so far are still returned.
+// Sites still running when the run deadline passes fail with a timeout.
+func WebScraper(ctx context.Context, allConfigs []appconfig.SiteConfig, opts Options) ([]appconfig.EventConfig, []appconfig.SiteReport) {
+	runTimeout := timeoutOrDefault(opts.RunTimeout, defaultRunTimeout)
+	ctx, cancel := withTimeout(ctx, runTimeout)
+	defer cancel()
+
 	jobs := make(chan Job, len(allConfigs))
 	results := make(chan Result, len(allConfigs))
 
 	// Start worker pool
 	for i := 0; i < maxWorkers; i++ {
-		go worker(jobs, results)
+		go worker(ctx, jobs, results, opts)
 	}
 
 	// Send jobs to the pool
-	for _, config := range allConfigs {
-		jobs <- Job{config: config}
+	for i, config := range allConfigs {
+		jobs <- Job{index: i, config: config}
 	}
 	close(jobs)
 
 	// Collect results
 	var scrapedEvents []appconfig.EventConfig
+	reports := make([]appconfig.SiteReport, len(allConfigs))
 	for i := 0; i < len(allConfigs); i++ {
 		result := <-results
-		if result.err != nil {
-			log.Errorf("Error processing job: %v", result.err)
-		} else {
-			scrapedEvents = append(scrapedEvents, result.events...)
+		if result.report.Error != "" {
+			log.Errorf("Error processing job: %s (%s)", result.report.Error, result.report.ErrorKind)
+		}
+		scrapedEvents = append(scrapedEvents, result.events...)
+		reports[result.index] = result.report
+		if opts.OnSiteDone != nil {
+			opts.OnSiteDone(result.config, result.report)
 		}
 	}
 
-	return scrapedEvents
+	return scrapedEvents, reports
 }
 
-func worker(jobs <-chan Job, results chan<- Result) {
+func worker(ctx context.Context, jobs <-chan Job, results chan<- Result, opts Options) {
 	for job := range jobs {
-		log.Infof("Starting extraction for site: %s", job.config.UrlToVisit)
-		events, err := extractEvents(job.config)
-		if err != nil {
-			results <- Result{err: err}
-		} else {
-			results <- Result{events: events}
+		startedAt := time.Now()
+		stats := &siteStats{}
+
+		var events []appconfig.EventConfig
+		err := ctx.Err()
+		if err == nil {
+			log.Infof("Starting extraction for site: %s", job.config.UrlToVisit)
+			events, err = extractSite(ctx, job.config, opts, stats)
+			log.Infof("Finished extraction for site: %s", job.config.UrlToVisit)
+		}
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+			err = fmt.Errorf("%w: the run took longer than %v", errDeadline, timeoutOrDefault(opts.RunTimeout, defaultRunTimeout))
+		}
+
+		report := siteReport(job.config, startedAt, stats, len(events), err)
+		report.Filled = countFilled(job.config, events)
+		results <- Result{
+			index:  job.index,
+			config: job.config,
+			events: events,
+			report: report,
 		}
-		log.Infof("Finished extraction for site: %s", job.config.UrlToVisit)
 	}
 }
 
-func extractEvents(config appconfig.SiteConfig) ([]appconfig.EventConfig, error) {
-	var extractedEvents []appconfig.EventConfig
+// extractSite extracts the events of a site within its deadline.
+func extractSite(ctx context.Context, config appconfig.SiteConfig, opts Options, stats *siteStats) ([]appconfig.EventConfig, error) {
+	timeout := opts.SiteTimeout
+	if config.TimeoutSeconds != 0 {
+		timeout = time.Duration(config.TimeoutSeconds) * time.Second
+	}
+	timeout = timeoutOrDefault(timeout, defaultSiteTimeout)
 
-	for retries := 0; retries < maxRetries; retries++ {
-		// Prepare the request to the Puppeteer service
-		reqBody, err := json.Marshal(map[string]string{
-			"url":      config.UrlToVisit,
-			"selector": config.AnchestorSelector,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("error preparing request: %v", err)
+	siteCtx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	events, err := extractEvents(siteCtx, config, opts, stats)
+	if err != nil && siteCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return events, fmt.Errorf("%w: the site took longer than %v", errDeadline, timeout)
+	}
+	return events, err
+}
+
+// timeoutOrDefault returns fallback for a zero timeout and zero, meaning no deadline, for a negative one.
+func timeoutOrDefault(timeout, fallback time.Duration) time.Duration {
+	switch {
+	case timeout == 0:
+		return fallback
+	case timeout < 0:
+		return 0
+	default:
+		return timeout
+	}
+}
+
+// withTimeout is context.WithTimeout that doesn't set a deadline for a zero timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// siteReport summarizes the crawl of a site.
+func siteReport(config appconfig.SiteConfig, startedAt time.Time, stats *siteStats, events int, err error) appconfig.SiteReport {
+	report := appconfig.SiteReport{
+		URL:        config.UrlToVisit,
+		EventType:  config.EventType,
+		Status:     appconfig.SiteOK,
+		StartedAt:  startedAt,
+		Duration:   time.Since(startedAt),
+		Pages:      stats.pages,
+		Retries:    int(atomic.LoadInt32(&stats.retries)),
+		Events:     events,
+		Rejected:   stats.rejected,
+		Disallowed: int(atomic.LoadInt32(&stats.disallowed)),
+		Structured: config.Structured,
+	}
+
+	// A listing that matches nothing is a sign of a broken selector rather than an empty site
+	if err == nil && stats.pages > 0 && stats.firstPageEvents == 0 {
+		switch {
+		case config.Structured == appconfig.StructuredOnly && stats.rejected > 0:
+			err = fmt.Errorf("%w: all %d structured events were rejected", errNoMatch, stats.rejected)
+		case config.Structured == appconfig.StructuredOnly:
+			err = fmt.Errorf("%w: no schema.org events in JSON-LD or microdata", errNoMatch)
+		case stats.rejected > 0:
+			err = fmt.Errorf("%w: all %d matched elements were rejected, check TitleSelector and LinkSelector", errNoMatch, stats.rejected)
+		default:
+			err = fmt.Errorf("%w: AnchestorSelector matched nothing", errNoMatch)
 		}
+	}
 
-		resp, err := http.Post("http://localhost:3000/scrape", "application/json", bytes.NewBuffer(reqBody))
-		if err != nil {
-			log.Errorf("Error making request to Puppeteer service: %v", err)
-			if retries < maxRetries-1 {
-				log.Infof("Retrying... (%d/%d)", retries+1, maxRetries)
-				time.Sleep(2 * time.Second)
-				continue
-			}
-			return nil, fmt.Errorf("failed to scrape after %d retries", maxRetries)
+	if err != nil {
+		report.ErrorKind = classifyError(err)
+		report.Error = err.Error()
+		switch {
+		case report.ErrorKind == appconfig.ErrorCancelled:
+			report.Status = appconfig.SiteCancelled
+		case report.ErrorKind == appconfig.ErrorNoMatch:
+			report.Status = appconfig.SiteEmpty
+		case events > 0:
+			// Events of the pages fetched before the error are kept
+			report.Status = appconfig.SitePartial
+		case report.ErrorKind == appconfig.ErrorDisallowed:
+			report.Status = appconfig.SiteSkipped
+		default:
+			report.Status = appconfig.SiteFailed
+		}
+	} else if events == 0 {
+		report.Status = appconfig.SiteEmpty
+	}
+
+	return report
+}
+
+// countFilled counts the events whose fields were found by the selectors.
+func countFilled(config appconfig.SiteConfig, events []appconfig.EventConfig) appconfig.FieldCounts {
+	var filled appconfig.FieldCounts
+	for _, event := range events {
+		if event.Title != "" {
+			filled.Title++
+		}
+		if event.Date != "" {
+			filled.Date++
 		}
-		defer resp.Body.Close()
+		if event.Link != "" && event.Link != config.UrlToVisit {
+			filled.Link++
+		}
+	}
+	return filled
+}
+
+// extractEvents crawls the listing pages of a site and their detail pages.
+// If a later page fails or ctx is done after the first page, the events found
+// so far are returned with the error.
+func extractEvents(ctx context.Context, config appconfig.SiteConfig, opts Options, stats *siteStats) ([]appconfig.EventConfig, error) {
+	var extractedEvents []appconfig.EventConfig
+	var stopErr error
 
-		body, err := ioutil.ReadAll(resp.Body)
+	fetcher, err := fetcherFor(config)
+	if err != nil {
+		return nil, err
+	}
+	fetcher = politeFetcherFor(fetcher, config, opts, stats)
+
+	pageURL := config.UrlToVisit
+	visited := make(map[string]bool)
+
+	for page := 1; page <= maxPagesFor(config); page++ {
+		visited[pageURL] = true
+
+		doc, err := fetchDocument(ctx, fetcher, pageURL, listingWaitSelector(config), stats)
 		if err != nil {
-			return nil, fmt.Errorf("error reading response: %v", err)
+			if page == 1 {
+				return nil, err
+			}
+			if ctx.Err() != nil {
+				stopErr = err
+				break
+			}
+			log.Errorf("Error fetching page %d of %s, keeping %d events: %v", page, config.UrlToVisit, len(extractedEvents), err)
+			stopErr = fmt.Errorf("page %d: %w", page, err)
+			break
 		}
+		stats.pages++
 
-		var result struct {
-			HTML string `json:"html"`
+		pageEvents, rejected := extractPageEvents(config, pageURL, doc)
+		stats.rejected += rejected
+		if page == 1 {
+			stats.firstPageEvents = len(pageEvents)
 		}
-		if err := json.Unmarshal(body, &result); err != nil {
-			return nil, fmt.Errorf("error parsing response: %v", err)
+		log.Infof("Page %d of %s: %d events, %d rejected", page, config.UrlToVisit, len(pageEvents), rejected)
+		if len(pageEvents) == 0 && config.StopWhenEmpty {
+			break
 		}
+		extractedEvents = append(extractedEvents, pageEvents...)
 
-		// Process the HTML content as before
-		doc, err := goquery.NewDocumentFromReader(strings.NewReader(result.HTML))
+		nextURL, err := nextPageURL(config, pageURL, page+1, doc)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing HTML: %v", err)
+			log.Errorf("Error resolving next page of %s: %v", config.UrlToVisit, err)
+			break
 		}
+		if nextURL == "" || visited[nextURL] {
+			break
+		}
+		pageURL = nextURL
+	}
 
-		doc.Find(config.AnchestorSelector).Each(func(i int, s *goquery.Selection) {
-			event, err := extractEventFromElement(config, s)
-			if err != nil {
-				log.Errorf("Error extracting event: %v", err)
-				return
-			}
-			extractedEvents = append(extractedEvents, event)
-		})
-
-		return extractedEvents, nil
+	if err := enrichWithDetails(ctx, config, fetcher, extractedEvents, stats); err != nil {
+		stopErr = err
 	}
+	parseEventDates(config, opts, extractedEvents)
 
-	return nil, fmt.Errorf("failed to extract events after %d retries", maxRetries)
+	return extractedEvents, stopErr
 }
 
-// extractEventFromElement extracts an event from a HTML element based on site configuration.
-func extractEventFromElement(config appconfig.SiteConfig, element *goquery.Selection) (appconfig.EventConfig, error) {
-	baseURL, err := url.Parse(config.UrlToVisit)
+// listingWaitSelector returns the selector the browser waits for on listing pages.
+func listingWaitSelector(config appconfig.SiteConfig) string {
+	if config.AnchestorSelector == "" {
+		return "body"
+	}
+	return config.AnchestorSelector
+}
+
+// fetchDocument fetches a page and parses it into a document. URLs disallowed
+// by robots.txt are counted in stats, which may be nil.
+func fetchDocument(ctx context.Context, fetcher Fetcher, pageURL, selector string, stats *siteStats) (*goquery.Document, error) {
+	html, err := fetcher.Fetch(ctx, pageURL, selector)
 	if err != nil {
-		return appconfig.EventConfig{}, fmt.Errorf("error parsing base URL: %v", err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, errDisallowed) {
+			stats.skipped()
+			return nil, err
+		}
+		return nil, fmt.Errorf("error fetching page: %w", err)
 	}
 
-	href, exists := element.Find(config.LinkSelector).Attr("href")
-	log.Infof("Link found: %v (exists: %v)", href, exists)
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, &ParseError{Err: fmt.Errorf("error parsing HTML: %v", err)}
+	}
+	return doc, nil
+}
 
-	var fullURL *url.URL
-	if exists {
-		link, err := url.Parse(href)
-		if err != nil {
-			return appconfig.EventConfig{}, fmt.Errorf("error parsing link URL: %v", err)
+// extractPageEvents extracts every event matched by the ancestor selector on a page,
+// or described by its structured data, depending on config.Structured.
+// Elements without a title or with a broken link are rejected and counted.
+func extractPageEvents(config appconfig.SiteConfig, pageURL string, doc *goquery.Document) ([]appconfig.EventConfig, int) {
+	var pageEvents []appconfig.EventConfig
+	rejected := 0
+
+	var structured []structuredEvent
+	if config.Structured != "" {
+		structured = structuredEvents(doc)
+	}
+	if config.Structured == appconfig.StructuredOnly {
+		for i, data := range structured {
+			event, err := eventFromStructured(config, pageURL, data)
+			if err != nil {
+				log.Errorf("Error extracting event: %v", err)
+				rejected++
+				continue
+			}
+			if event.Title == "" {
+				log.Warnf("Structured event %d on %s has no name, skipped", i, pageURL)
+				rejected++
+				continue
+			}
+			pageEvents = append(pageEvents, event)
 		}
-		fullURL = baseURL.ResolveReference(link)
+		return pageEvents, rejected
 	}
 
+	doc.Find(config.AnchestorSelector).Each(func(i int, s *goquery.Selection) {
+		event, err := extractEventFromElement(config, pageURL, s)
+		if err != nil {
+			log.Errorf("Error extracting event: %v", err)
+			rejected++
+			return
+		}
+		if data, ok := matchStructured(config, pageURL, event, structured); ok {
+			fillFromStructured(config, pageURL, &event, data)
+		}
+		if event.Title == "" {
+			log.Warnf("Element %d on %s has no title, skipped", i, pageURL)
+			rejected++
+			return
+		}
+		pageEvents = append(pageEvents, event)
+	})
+
+	return pageEvents, rejected
+}
+
+// extractEventFromElement extracts an event from a HTML element based on site configuration.
+// Relative links are resolved against pageURL.
+func extractEventFromElement(config appconfig.SiteConfig, pageURL string, element *goquery.Selection) (appconfig.EventConfig, error) {
+	href, exists := element.Find(config.LinkSelector).Attr("href")
+	log.Infof("Link found: %v (exists: %v)", href, exists)
+
 	eventToExtract := appconfig.EventConfig{
 		Title:     strings.TrimSpace(element.Find(config.TitleSelector).Text()),
 		Date:      strings.TrimSpace(element.Find(config.DateSelector).Text()),
 		Location:  config.LocationSelector,
 		Link:      config.UrlToVisit,
 		EventType: config.EventType,
+		Source:    config.UrlToVisit,
 	}
 
-	if fullURL != nil {
-		eventToExtract.Link = fullURL.String()
+	if exists {
+		fullURL, err := resolveLink(pageURL, href)
+		if err != nil {
+			return appconfig.EventConfig{}, err
+		}
+		eventToExtract.Link = fullURL
 	}
 
 	log.Infof("Extracted event details: %+v", eventToExtract)
 
 	return eventToExtract, nil
 }
+
+// resolveLink resolves href relative to the page it was found on.
+func resolveLink(pageURL, href string) (string, error) {
+	baseURL, err := url.Parse(pageURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing base URL: %v", err)
+	}
+
+	link, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", fmt.Errorf("error parsing link URL: %v", err)
+	}
+
+	return baseURL.ResolveReference(link).String(), nil
+}
+
+// parseEventDates fills Start and End of every event from its raw Date.
+func parseEventDates(config appconfig.SiteConfig, opts Options, events []appconfig.EventConfig) {
+	location := opts.Location
+	if config.Timezone != "" {
+		siteLocation, err := dates.LoadLocation(config.Timezone)
+		if err != nil {
+			log.Errorf("Error loading timezone for %s: %v", config.UrlToVisit, err)
+		} else {
+			location = siteLocation
+		}
+	}
+
+	parser := dates.NewParser(location)
+	for i := range events {
+		if events[i].Date == "" {
+			continue
+		}
+		parsed, err := parser.Parse(events[i].Date)
+		if err != nil {
+			log.Warnf("Error parsing date of %s: %v", events[i].Link, err)
+			continue
+		}
+		events[i].Start = parsed.Start
+		events[i].End = parsed.End
+	}
+}
@@ -0,0 +1,275 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+// listingPage renders a listing with one event per title and an optional next-page link.
+func listingPage(next string, titles ...string) string {
+	var b strings.Builder
+	b.WriteString("<html><body>")
+	for _, title := range titles {
+		slug := strings.ReplaceAll(strings.ToLower(title), " ", "-")
+		fmt.Fprintf(&b, `<div class="e"><h3><a href="/event/%s">%s</a></h3><span class="d">2024-10-15</span></div>`, slug, title)
+	}
+	if next != "" {
+		fmt.Fprintf(&b, `<a class="next" href="%s">Next</a>`, next)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+// newTestSite serves the listing pages of the crawl tests.
+func newTestSite(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	pages := map[string]string{
+		"/tpl/1":   listingPage("", "Concert A", "Concert B"),
+		"/tpl/2":   listingPage("", "Concert C", "Concert D"),
+		"/tpl/3":   listingPage(""),
+		"/next/1":  listingPage("/next/2", "Play A"),
+		"/next/2":  listingPage("", "Play B"),
+		"/mixed/1": listingPage("/mixed/2", "Talk A"),
+		"/mixed/2": listingPage("", "Talk B"),
+		"/mixed/3": listingPage("", "Talk C"),
+		"/mixed/4": listingPage("", "Talk D"),
+
+		"/broken/1": listingPage("/broken/2", "Show A"),
+		"/flaky":    listingPage("", "Lecture A"),
+		"/empty":    "<html><body><p>Nothing planned</p></body></html>",
+	}
+
+	var mu sync.Mutex
+	flakyCalls := 0
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			io.WriteString(w, "User-agent: *\nDisallow: /private\n")
+			return
+		case "/flaky":
+			// Fails only the first time
+			mu.Lock()
+			flakyCalls++
+			first := flakyCalls == 1
+			mu.Unlock()
+			if first {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/down", "/broken/2":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, page)
+	})
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testSite returns a static site configuration for a page of the test server.
+func testSite(server *httptest.Server, path string) appconfig.SiteConfig {
+	return appconfig.SiteConfig{
+		UrlToVisit:        server.URL + path,
+		EventType:         "test",
+		AnchestorSelector: ".e",
+		TitleSelector:     "h3",
+		DateSelector:      ".d",
+		LinkSelector:      "a",
+		Render:            RenderStatic,
+		IgnoreRobots:      true,
+	}
+}
+
+// crawlCase is a site crawled by WebScraper and the report expected for it.
+type crawlCase struct {
+	name      string
+	config    appconfig.SiteConfig
+	status    appconfig.SiteStatus
+	errorKind appconfig.ErrorKind
+	// errorText is a part of the reported error
+	errorText string
+	titles    []string
+	pages     int
+	retries   int
+}
+
+// checkCrawl crawls all cases in one run, without rate limits and with quick
+// retries, and compares the reports and events of every site.
+func checkCrawl(t *testing.T, server *httptest.Server, tests []crawlCase) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+
+	configs := make([]appconfig.SiteConfig, len(tests))
+	for i, tt := range tests {
+		configs[i] = tt.config
+	}
+
+	events, reports := WebScraper(context.Background(), configs, Options{
+		RateLimit: appconfig.RateLimit{RequestsPerSecond: -1, MaxConcurrency: -1},
+		UserAgent: "CrawlerTest/1.0",
+		Retry:     appconfig.RetryConfig{MaxAttempts: 2, BaseDelayMs: 1, MaxDelayMs: 10, Jitter: -1},
+	})
+	if len(reports) != len(configs) {
+		t.Fatalf("WebScraper returned %d reports for %d sites", len(reports), len(configs))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := reports[i]
+			if report.URL != configs[i].UrlToVisit {
+				t.Fatalf("report %d is for %s, want %s", i, report.URL, configs[i].UrlToVisit)
+			}
+			if report.Status != tt.status || report.ErrorKind != tt.errorKind {
+				t.Errorf("status = %s (%s), want %s (%s); error: %s", report.Status, report.ErrorKind, tt.status, tt.errorKind, report.Error)
+			}
+			if !strings.Contains(report.Error, tt.errorText) {
+				t.Errorf("error = %q, want it to contain %q", report.Error, tt.errorText)
+			}
+			if report.Pages != tt.pages {
+				t.Errorf("pages = %d, want %d", report.Pages, tt.pages)
+			}
+			if report.Retries != tt.retries {
+				t.Errorf("retries = %d, want %d", report.Retries, tt.retries)
+			}
+			if report.Events != len(tt.titles) {
+				t.Errorf("events = %d, want %d", report.Events, len(tt.titles))
+			}
+
+			var titles []string
+			for _, event := range events {
+				if event.Source == configs[i].UrlToVisit {
+					titles = append(titles, event.Title)
+				}
+			}
+			if strings.Join(titles, "|") != strings.Join(tt.titles, "|") {
+				t.Errorf("titles = %q, want %q", titles, tt.titles)
+			}
+		})
+	}
+
+	// Links are resolved against the page and dates are parsed
+	for _, event := range events {
+		if !strings.HasPrefix(event.Link, server.URL+"/event/") {
+			t.Errorf("event %q has link %q, want an absolute link to its page", event.Title, event.Link)
+		}
+		if event.Start.IsZero() {
+			t.Errorf("event %q has no parsed start date", event.Title)
+		}
+	}
+}
+
+func TestWebScraperPagination(t *testing.T) {
+	server := newTestSite(t)
+
+	template := testSite(server, "/tpl/1")
+	template.PageURLTemplate = server.URL + "/tpl/" + appconfig.PagePlaceholder
+	template.MaxPages = 5
+	template.StopWhenEmpty = true
+
+	next := testSite(server, "/next/1")
+	next.NextPageSelector = "a.next"
+
+	mixed := testSite(server, "/mixed/1")
+	mixed.NextPageSelector = "a.next"
+	mixed.PageURLTemplate = server.URL + "/mixed/" + appconfig.PagePlaceholder
+	mixed.MaxPages = 3
+
+	checkCrawl(t, server, []crawlCase{
+		{
+			name:   "url template until an empty page",
+			config: template,
+			status: appconfig.SiteOK,
+			titles: []string{"Concert A", "Concert B", "Concert C", "Concert D"},
+			pages:  3,
+		},
+		{
+			name:   "next-page link until there is none",
+			config: next,
+			status: appconfig.SiteOK,
+			titles: []string{"Play A", "Play B"},
+			pages:  2,
+		},
+		{
+			name:   "template after the next-page link runs out, up to MaxPages",
+			config: mixed,
+			status: appconfig.SiteOK,
+			titles: []string{"Talk A", "Talk B", "Talk C"},
+			pages:  3,
+		},
+	})
+}
+
+func TestWebScraperReports(t *testing.T) {
+	server := newTestSite(t)
+
+	broken := testSite(server, "/broken/1")
+	broken.NextPageSelector = "a.next"
+
+	robots := testSite(server, "/private/events")
+	robots.IgnoreRobots = false
+
+	checkCrawl(t, server, []crawlCase{
+		{
+			name:      "failing later page keeps earlier events",
+			config:    broken,
+			status:    appconfig.SitePartial,
+			errorKind: appconfig.ErrorHTTPStatus,
+			errorText: "page 2: ",
+			titles:    []string{"Show A"},
+			pages:     1,
+			retries:   1,
+		},
+		{
+			name:    "server error retried once",
+			config:  testSite(server, "/flaky"),
+			status:  appconfig.SiteOK,
+			titles:  []string{"Lecture A"},
+			pages:   1,
+			retries: 1,
+		},
+		{
+			name:      "persistent server error",
+			config:    testSite(server, "/down"),
+			status:    appconfig.SiteFailed,
+			errorKind: appconfig.ErrorHTTPStatus,
+			retries:   1,
+		},
+		{
+			name:      "not found is not retried",
+			config:    testSite(server, "/missing"),
+			status:    appconfig.SiteFailed,
+			errorKind: appconfig.ErrorHTTPStatus,
+		},
+		{
+			name:      "listing without events",
+			config:    testSite(server, "/empty"),
+			status:    appconfig.SiteEmpty,
+			errorKind: appconfig.ErrorNoMatch,
+			pages:     1,
+		},
+		{
+			name:      "disallowed by robots.txt",
+			config:    robots,
+			status:    appconfig.SiteSkipped,
+			errorKind: appconfig.ErrorDisallowed,
+		},
+	})
+}
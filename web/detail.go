@@ -0,0 +1,109 @@
+package web
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+const defaultDetailConcurrency = 4
+
+// detailSlots bounds detail fetches across all sites to the size of the worker pool.
+var detailSlots = make(chan struct{}, maxWorkers)
+
+// enrichWithDetails follows the link of every event and merges the fields found
+// on its detail page. Events whose detail page fails keep their listing values;
+// only cancellation of ctx is returned as an error.
+func enrichWithDetails(ctx context.Context, config appconfig.SiteConfig, fetcher Fetcher, events []appconfig.EventConfig, stats *siteStats) error {
+	detail := config.Detail
+	if detail == nil {
+		return nil
+	}
+
+	concurrency := detail.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultDetailConcurrency
+	}
+
+	waitSelector := detail.WaitSelector
+	if waitSelector == "" {
+		waitSelector = "body"
+	}
+
+	siteSlots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := range events {
+		// Without a link of its own the event has no detail page
+		if events[i].Link == "" || events[i].Link == config.UrlToVisit {
+			continue
+		}
+
+		wg.Add(1)
+		go func(event *appconfig.EventConfig) {
+			defer wg.Done()
+
+			if !acquire(ctx, siteSlots) {
+				return
+			}
+			defer func() { <-siteSlots }()
+			if !acquire(ctx, detailSlots) {
+				return
+			}
+			defer func() { <-detailSlots }()
+
+			doc, err := fetchDocument(ctx, fetcher, event.Link, waitSelector, stats)
+			if err != nil {
+				log.Errorf("Error fetching detail page %s: %v", event.Link, err)
+				return
+			}
+			mergeDetails(detail, doc, event)
+			mergeStructured(config, doc, event)
+		}(&events[i])
+	}
+
+	wg.Wait()
+	return ctx.Err()
+}
+
+// acquire takes a slot from a semaphore channel unless ctx is cancelled first.
+func acquire(ctx context.Context, slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// mergeStructured fills empty fields of the event from the structured data of its
+// detail page, if the page describes exactly one event.
+func mergeStructured(config appconfig.SiteConfig, doc *goquery.Document, event *appconfig.EventConfig) {
+	if config.Structured == "" {
+		return
+	}
+	if found := structuredEvents(doc); len(found) == 1 {
+		fillFromStructured(config, event.Link, event, found[0])
+	}
+}
+
+// mergeDetails copies non-empty detail fields into the event.
+func mergeDetails(detail *appconfig.DetailConfig, doc *goquery.Document, event *appconfig.EventConfig) {
+	mergeField(doc, detail.TitleSelector, &event.Title)
+	mergeField(doc, detail.DateSelector, &event.Date)
+	mergeField(doc, detail.LocationSelector, &event.Location)
+	mergeField(doc, detail.PriceSelector, &event.Price)
+	mergeField(doc, detail.DescriptionSelector, &event.Description)
+}
+
+func mergeField(doc *goquery.Document, selector string, field *string) {
+	if selector == "" {
+		return
+	}
+	if value := strings.TrimSpace(doc.Find(selector).First().Text()); value != "" {
+		*field = value
+	}
+}
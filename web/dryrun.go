@@ -0,0 +1,129 @@
+package web
+
+import (
+	"context"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+// DefaultSampleSize is the number of events a dry run returns when no limit is given.
+const DefaultSampleSize = 5
+
+// DryRunReport describes what a site configuration extracts from the first page of a site.
+type DryRunReport struct {
+	PageURL string
+	// Matched is the number of elements matched by AnchestorSelector,
+	// or of structured events if the site uses structured data only
+	Matched int
+	// Structured is SiteConfig.Structured of the checked site
+	Structured string
+	// StructuredEvents is the number of schema.org events found on the page, if Structured is set
+	StructuredEvents int
+	// Samples holds the first extracted events
+	Samples []SampleEvent
+	// NextPageURL is the page that would be crawled next, empty if there is none
+	NextPageURL string
+}
+
+// SampleEvent is an extracted event together with the selectors that found nothing in it.
+type SampleEvent struct {
+	Event appconfig.EventConfig
+	// EmptySelectors names the SiteConfig fields whose selector returned nothing
+	EmptySelectors []string
+}
+
+// DryRun fetches the first page of a site and extracts up to limit events the same way
+// a crawl does, including detail pages and date parsing, without writing them anywhere.
+func DryRun(ctx context.Context, config appconfig.SiteConfig, opts Options, limit int) (DryRunReport, error) {
+	if limit <= 0 {
+		limit = DefaultSampleSize
+	}
+	report := DryRunReport{PageURL: config.UrlToVisit, Structured: config.Structured}
+
+	fetcher, err := fetcherFor(config)
+	if err != nil {
+		return report, err
+	}
+	fetcher = politeFetcherFor(fetcher, config, opts, nil)
+
+	doc, err := fetchDocument(ctx, fetcher, config.UrlToVisit, listingWaitSelector(config), nil)
+	if err != nil {
+		return report, err
+	}
+
+	var structured []structuredEvent
+	if config.Structured != "" {
+		structured = structuredEvents(doc)
+		report.StructuredEvents = len(structured)
+	}
+
+	var events []appconfig.EventConfig
+	var empty [][]string
+	if config.Structured == appconfig.StructuredOnly {
+		report.Matched = len(structured)
+		for _, data := range structured {
+			if len(events) == limit {
+				break
+			}
+			event, err := eventFromStructured(config, config.UrlToVisit, data)
+			if err != nil {
+				log.Errorf("Error extracting event: %v", err)
+				continue
+			}
+			events = append(events, event)
+			empty = append(empty, nil)
+		}
+	} else {
+		elements := doc.Find(config.AnchestorSelector)
+		report.Matched = elements.Length()
+		elements.EachWithBreak(func(i int, s *goquery.Selection) bool {
+			event, err := extractEventFromElement(config, config.UrlToVisit, s)
+			if err != nil {
+				log.Errorf("Error extracting event: %v", err)
+				return true
+			}
+			if data, ok := matchStructured(config, config.UrlToVisit, event, structured); ok {
+				fillFromStructured(config, config.UrlToVisit, &event, data)
+			}
+			events = append(events, event)
+			empty = append(empty, emptySelectors(config, s))
+			return len(events) < limit
+		})
+	}
+
+	if err := enrichWithDetails(ctx, config, fetcher, events, nil); err != nil {
+		return report, err
+	}
+	parseEventDates(config, opts, events)
+
+	for i, event := range events {
+		report.Samples = append(report.Samples, SampleEvent{Event: event, EmptySelectors: empty[i]})
+	}
+
+	if isPaginated(config) {
+		if report.NextPageURL, err = nextPageURL(config, config.UrlToVisit, 2, doc); err != nil {
+			log.Errorf("Error resolving next page of %s: %v", config.UrlToVisit, err)
+		}
+	}
+
+	return report, nil
+}
+
+// emptySelectors lists the listing selectors that found no text, or no href for the link.
+func emptySelectors(config appconfig.SiteConfig, element *goquery.Selection) []string {
+	var empty []string
+	if strings.TrimSpace(element.Find(config.TitleSelector).Text()) == "" {
+		empty = append(empty, "TitleSelector")
+	}
+	if strings.TrimSpace(element.Find(config.DateSelector).Text()) == "" {
+		empty = append(empty, "DateSelector")
+	}
+	if config.LinkSelector != "" {
+		if _, exists := element.Find(config.LinkSelector).Attr("href"); !exists {
+			empty = append(empty, "LinkSelector")
+		}
+	}
+	return empty
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/retry"
+)
+
+// HTTPStatusError is returned when a page answers with an unexpected status code.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	// retryAfter is the delay requested by the Retry-After header, zero if absent
+	retryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d for %s", e.StatusCode, e.URL)
+}
+
+// Retryable reports whether the request is worth repeating: rate limiting and
+// server errors are, other client errors are not.
+func (e *HTTPStatusError) Retryable() bool {
+	return retry.RetryableStatus(e.StatusCode)
+}
+
+// RetryAfter returns the delay requested by the server.
+func (e *HTTPStatusError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// RenderTimeoutError is returned when the browser couldn't load a page or
+// find the awaited selector in time.
+type RenderTimeoutError struct {
+	URL      string
+	Selector string
+	Message  string
+	// SelectorMiss is set when the page loaded but the selector never appeared
+	SelectorMiss bool
+}
+
+func (e *RenderTimeoutError) Error() string {
+	if e.SelectorMiss {
+		return fmt.Sprintf("selector %q not found on %s: %s", e.Selector, e.URL, e.Message)
+	}
+	return fmt.Sprintf("render timeout for %s waiting for %q: %s", e.URL, e.Selector, e.Message)
+}
+
+// Retryable reports whether the page failed to load: slow pages often load
+// on the next attempt, while a selector that matches nothing won't start matching.
+func (e *RenderTimeoutError) Retryable() bool {
+	return !e.SelectorMiss
+}
+
+// ParseError is returned when a fetched page or a link on it can't be parsed.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// errNoMatch is reported when the first page of a site yields no events.
+var errNoMatch = errors.New("no events on the first page")
+
+// errBrowserNetwork is returned when the browser couldn't reach the site.
+var errBrowserNetwork = errors.New("browser network error")
+
+// errDisallowed is returned for URLs that robots.txt doesn't allow to crawl.
+var errDisallowed = errors.New("disallowed by robots.txt")
+
+// errDeadline is returned for sites stopped by the site or run deadline.
+var errDeadline = errors.New("deadline exceeded")
+
+// errUnknownRender is returned for a render mode without a registered Fetcher.
+var errUnknownRender = errors.New("unknown render mode")
+
+// isRetryable decides whether a failed fetch is repeated. Browser network errors
+// are retried like transport errors, parse errors and robots.txt refusals are not.
+func isRetryable(err error) bool {
+	var parseErr *ParseError
+	switch {
+	case errors.Is(err, errDisallowed), errors.As(err, &parseErr):
+		return false
+	case errors.Is(err, errBrowserNetwork):
+		return true
+	default:
+		return retry.IsRetryable(err)
+	}
+}
+
+// classifyError maps an error of a site crawl to an ErrorKind.
+func classifyError(err error) appconfig.ErrorKind {
+	var statusErr *HTTPStatusError
+	var timeoutErr *RenderTimeoutError
+	var parseErr *ParseError
+	var netErr net.Error
+	var urlErr *url.Error
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return appconfig.ErrorCancelled
+	case errors.Is(err, errDeadline):
+		return appconfig.ErrorTimeout
+	case errors.Is(err, errNoMatch):
+		return appconfig.ErrorNoMatch
+	case errors.Is(err, errDisallowed):
+		return appconfig.ErrorDisallowed
+	case errors.Is(err, errUnknownRender):
+		return appconfig.ErrorConfig
+	case errors.As(err, &timeoutErr):
+		return appconfig.ErrorRenderTimeout
+	case errors.As(err, &statusErr):
+		return appconfig.ErrorHTTPStatus
+	case errors.As(err, &parseErr):
+		return appconfig.ErrorParse
+	case errors.Is(err, errBrowserNetwork), errors.As(err, &netErr), errors.As(err, &urlErr), errors.Is(err, context.DeadlineExceeded):
+		return appconfig.ErrorNetwork
+	default:
+		return appconfig.ErrorUnknown
+	}
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/retry"
+)
+
+const (
+	// RenderBrowser renders pages through the Puppeteer service.
+	RenderBrowser = appconfig.RenderBrowser
+	// RenderStatic downloads pages with a plain HTTP GET.
+	RenderStatic = appconfig.RenderStatic
+
+	defaultBrowserEndpoint = "http://localhost:3000/scrape"
+	defaultHTTPTimeout     = 90 * time.Second
+)
+
+// Fetcher retrieves the HTML of a page. The selector is a hint for renderers
+// that have to wait for dynamic content to appear.
+type Fetcher interface {
+	Fetch(ctx context.Context, pageURL, selector string) (string, error)
+}
+
+// BrowserFetcher asks the Puppeteer service to render a page and returns the resulting HTML.
+type BrowserFetcher struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+// NewBrowserFetcher creates a BrowserFetcher for the given service endpoint.
+func NewBrowserFetcher(endpoint string) *BrowserFetcher {
+	return &BrowserFetcher{
+		Endpoint: endpoint,
+		Client:   &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+// Fetch renders pageURL in the headless browser and waits for selector.
+func (f *BrowserFetcher) Fetch(ctx context.Context, pageURL, selector string) (string, error) {
+	reqBody, err := json.Marshal(map[string]string{
+		"url":       pageURL,
+		"selector":  selector,
+		"userAgent": userAgentFrom(ctx),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error preparing request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.Endpoint, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("error preparing request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request to Puppeteer service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	var result struct {
+		HTML  string `json:"html"`
+		Error string `json:"error"`
+		Name  string `json:"name"`
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// Errors of the service itself or of a proxy in front of it may not be JSON
+		if err := json.Unmarshal(body, &result); err != nil {
+			result.Error = strings.TrimSpace(string(body))
+		}
+		switch {
+		case resp.StatusCode == http.StatusUnprocessableEntity || result.Name == "SelectorTimeoutError":
+			return "", &RenderTimeoutError{URL: pageURL, Selector: selector, Message: result.Error, SelectorMiss: true}
+		case resp.StatusCode == http.StatusGatewayTimeout || result.Name == "TimeoutError":
+			return "", &RenderTimeoutError{URL: pageURL, Selector: selector, Message: result.Error}
+		case strings.HasPrefix(result.Error, "net::"):
+			// Chrome network errors, e.g. net::ERR_NAME_NOT_RESOLVED
+			return "", fmt.Errorf("%w: %s", errBrowserNetwork, result.Error)
+		default:
+			statusErr := &HTTPStatusError{
+				URL:        f.Endpoint,
+				StatusCode: resp.StatusCode,
+				retryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After")),
+			}
+			return "", fmt.Errorf("Puppeteer service error for %s: %w (%s)", pageURL, statusErr, result.Error)
+		}
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", &ParseError{Err: fmt.Errorf("error parsing response: %v", err)}
+	}
+
+	return result.HTML, nil
+}
+
+// StaticFetcher downloads a page with a plain GET request, without rendering JavaScript.
+type StaticFetcher struct {
+	Client *http.Client
+}
+
+// NewStaticFetcher creates a StaticFetcher with a default HTTP client.
+func NewStaticFetcher() *StaticFetcher {
+	return &StaticFetcher{
+		Client: &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+// Fetch downloads pageURL. The selector is ignored since the page is not rendered.
+func (f *StaticFetcher) Fetch(ctx context.Context, pageURL, selector string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error preparing request: %v", err)
+	}
+	req.Header.Set("User-Agent", userAgentFrom(ctx))
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &HTTPStatusError{
+			URL:        pageURL,
+			StatusCode: resp.StatusCode,
+			retryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	return string(body), nil
+}
+
+// fetchers holds the Fetcher used for each render mode. Fetchers may be registered
+// while crawls are running, so access goes through fetchersMu.
+var (
+	fetchersMu sync.RWMutex
+	fetchers   = map[string]Fetcher{
+		RenderBrowser: NewBrowserFetcher(defaultBrowserEndpoint),
+		RenderStatic:  NewStaticFetcher(),
+	}
+)
+
+// RegisterFetcher sets the Fetcher used for a render mode, replacing any existing one.
+// The render mode becomes valid in site configurations.
+func RegisterFetcher(render string, fetcher Fetcher) {
+	fetchersMu.Lock()
+	fetchers[render] = fetcher
+	fetchersMu.Unlock()
+	appconfig.RegisterRender(render)
+}
+
+// fetcherFor returns the Fetcher matching the render mode of a site configuration.
+// Configurations without a render mode keep using the browser.
+func fetcherFor(config appconfig.SiteConfig) (Fetcher, error) {
+	render := config.Render
+	if render == "" {
+		render = RenderBrowser
+	}
+
+	fetchersMu.RLock()
+	fetcher, ok := fetchers[render]
+	fetchersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownRender, config.Render)
+	}
+	return fetcher, nil
+}
@@ -0,0 +1,221 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rx3lixir/crawler/appconfig"
+	"github.com/rx3lixir/crawler/retry"
+	"github.com/rx3lixir/crawler/robots"
+)
+
+const (
+	defaultRequestsPerSecond = 1
+	defaultBurst             = 2
+	defaultHostConcurrency   = 2
+)
+
+// hostStates is shared by all runs, so that concurrent runs together stay within the limits of a host.
+var hostStates = struct {
+	mu     sync.Mutex
+	byHost map[string]*hostState
+}{byHost: make(map[string]*hostState)}
+
+// hostState is a token bucket and a concurrency counter for one host. Each caller
+// passes its own limits, so sites with different settings share the same budget
+// but each obeys its own rate and cap.
+type hostState struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	active int
+	// freed is closed and replaced every time a request finishes
+	freed chan struct{}
+}
+
+// hostFor returns the state of the host of pageURL.
+func hostFor(pageURL string) *hostState {
+	host := pageURL
+	if u, err := url.Parse(pageURL); err == nil && u.Host != "" {
+		host = strings.ToLower(u.Host)
+	}
+
+	hostStates.mu.Lock()
+	defer hostStates.mu.Unlock()
+	state, ok := hostStates.byHost[host]
+	if !ok {
+		state = &hostState{freed: make(chan struct{})}
+		hostStates.byHost[host] = state
+	}
+	return state
+}
+
+// acquire waits until a request to the host is allowed by limit, or ctx is done.
+// The returned function must be called when the request finishes.
+func (h *hostState) acquire(ctx context.Context, limit appconfig.RateLimit) (func(), error) {
+	for {
+		h.mu.Lock()
+		now := time.Now()
+		burst := float64(limit.Burst)
+		if h.last.IsZero() {
+			h.tokens = burst
+		} else if limit.RequestsPerSecond > 0 {
+			h.tokens += now.Sub(h.last).Seconds() * limit.RequestsPerSecond
+		}
+		if h.tokens > burst {
+			h.tokens = burst
+		}
+		h.last = now
+
+		var wait <-chan time.Time
+		var timer *time.Timer
+		switch {
+		case limit.MaxConcurrency > 0 && h.active >= limit.MaxConcurrency:
+			// Wait for a running request to finish
+		case limit.RequestsPerSecond <= 0 || h.tokens >= 1:
+			if limit.RequestsPerSecond > 0 {
+				h.tokens--
+			}
+			h.active++
+			h.mu.Unlock()
+			return h.release, nil
+		default:
+			timer = time.NewTimer(time.Duration((1 - h.tokens) / limit.RequestsPerSecond * float64(time.Second)))
+			wait = timer.C
+		}
+		freed := h.freed
+		h.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-freed:
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (h *hostState) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.active--
+	close(h.freed)
+	h.freed = make(chan struct{})
+}
+
+// effectiveRateLimit merges the site override over the global settings over the defaults.
+func effectiveRateLimit(global appconfig.RateLimit, site *appconfig.RateLimit) appconfig.RateLimit {
+	limit := appconfig.RateLimit{
+		RequestsPerSecond: defaultRequestsPerSecond,
+		Burst:             defaultBurst,
+		MaxConcurrency:    defaultHostConcurrency,
+	}
+	for _, override := range []*appconfig.RateLimit{&global, site} {
+		if override == nil {
+			continue
+		}
+		if override.RequestsPerSecond != 0 {
+			limit.RequestsPerSecond = override.RequestsPerSecond
+		}
+		if override.Burst != 0 {
+			limit.Burst = override.Burst
+		}
+		if override.MaxConcurrency != 0 {
+			limit.MaxConcurrency = override.MaxConcurrency
+		}
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return limit
+}
+
+// politeFetcher applies robots.txt, the rate limit and the retry policy of a site
+// to every request made through a Fetcher.
+type politeFetcher struct {
+	Fetcher
+	limit     appconfig.RateLimit
+	userAgent string
+	policy    retry.Policy
+	// robots is nil for sites that ignore robots.txt
+	robots *robots.Checker
+}
+
+// politeFetcherFor wraps fetcher so that requests of config obey robots.txt and its rate limit
+// and are retried. Retries are counted in stats, which may be nil.
+func politeFetcherFor(fetcher Fetcher, config appconfig.SiteConfig, opts Options, stats *siteStats) Fetcher {
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	policy := retry.New(opts.Retry)
+	policy.Retryable = isRetryable
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		log.Warnf("Attempt %d/%d for %s failed, retrying in %v: %v", attempt, policy.MaxAttempts, config.UrlToVisit, delay.Round(time.Millisecond), err)
+		stats.retried()
+	}
+
+	polite := &politeFetcher{
+		Fetcher:   fetcher,
+		limit:     effectiveRateLimit(opts.RateLimit, config.RateLimit),
+		userAgent: userAgent,
+		policy:    policy,
+	}
+	if !config.IgnoreRobots {
+		polite.robots = robotsChecker(userAgent)
+	}
+	return polite
+}
+
+// Fetch checks robots.txt and fetches the page, waiting for the host of pageURL
+// to allow each attempt.
+func (f *politeFetcher) Fetch(ctx context.Context, pageURL, selector string) (string, error) {
+	limit := f.limit
+	if f.robots != nil {
+		allowed, crawlDelay, err := f.robots.Check(ctx, pageURL)
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			return "", fmt.Errorf("%w: %s", errDisallowed, pageURL)
+		}
+		limit = withCrawlDelay(limit, crawlDelay)
+	}
+
+	host := hostFor(pageURL)
+	var html string
+	err := f.policy.Do(ctx, func() error {
+		release, err := host.acquire(ctx, limit)
+		if err != nil {
+			return err
+		}
+		defer release()
+		html, err = f.Fetcher.Fetch(withUserAgent(ctx, f.userAgent), pageURL, selector)
+		return err
+	})
+	return html, err
+}
+
+// withCrawlDelay slows limit down to one request per crawl delay if it is faster.
+func withCrawlDelay(limit appconfig.RateLimit, crawlDelay time.Duration) appconfig.RateLimit {
+	if crawlDelay <= 0 {
+		return limit
+	}
+	rate := float64(time.Second) / float64(crawlDelay)
+	if limit.RequestsPerSecond <= 0 || limit.RequestsPerSecond > rate {
+		limit.RequestsPerSecond = rate
+		limit.Burst = 1
+	}
+	return limit
+}
@@ -0,0 +1,46 @@
+package web
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+// defaultMaxPages limits paginated sites that don't set MaxPages.
+const defaultMaxPages = 10
+
+// isPaginated reports whether the site configuration describes more than one page.
+func isPaginated(config appconfig.SiteConfig) bool {
+	return config.NextPageSelector != "" || config.PageURLTemplate != ""
+}
+
+// maxPagesFor returns how many pages may be visited for a site configuration.
+func maxPagesFor(config appconfig.SiteConfig) int {
+	if !isPaginated(config) {
+		return 1
+	}
+	if config.MaxPages > 0 {
+		return config.MaxPages
+	}
+	return defaultMaxPages
+}
+
+// nextPageURL returns the URL of page number nextPage, or an empty string if there is none.
+// A next-page link on the current page takes precedence over the URL template,
+// which is used when the page has no such link.
+func nextPageURL(config appconfig.SiteConfig, pageURL string, nextPage int, doc *goquery.Document) (string, error) {
+	if config.NextPageSelector != "" {
+		href, exists := doc.Find(config.NextPageSelector).First().Attr("href")
+		if exists && strings.TrimSpace(href) != "" {
+			return resolveLink(pageURL, href)
+		}
+	}
+
+	if config.PageURLTemplate != "" {
+		return strings.ReplaceAll(config.PageURLTemplate, appconfig.PagePlaceholder, strconv.Itoa(nextPage)), nil
+	}
+
+	return "", nil
+}
@@ -60,7 +60,7 @@ class BrowserPool {
 const browserPool = new BrowserPool(POOL_SIZE);
 
 app.post("/scrape", async (req, res) => {
-  const { url, selector } = req.body;
+  const { url, selector, userAgent } = req.body;
   if (!url || !selector) {
     return res.status(400).json({ error: "URL and selector must be provided" });
   }
@@ -68,17 +68,36 @@ app.post("/scrape", async (req, res) => {
   const browser = await browserPool.getBrowser();
   try {
     const page = await browser.newPage();
+    if (userAgent) {
+      await page.setUserAgent(userAgent);
+    }
     logger.info(`Navigating to ${url}`);
     await page.goto(url, { waitUntil: "networkidle2", timeout: 60000 });
     logger.info(`Waiting for selector ${selector}`);
-    await page.waitForSelector(selector, { timeout: 60000 });
+    try {
+      await page.waitForSelector(selector, { timeout: 60000 });
+    } catch (error) {
+      // The page loaded but the selector never appeared, retrying won't help
+      if (error.name === "TimeoutError") {
+        error.name = "SelectorTimeoutError";
+      }
+      throw error;
+    }
     const html = await page.content();
     logger.info("Page content fetched");
     await page.close();
     res.json({ html });
   } catch (error) {
     logger.error(`Error: ${error.message}`);
-    res.status(500).json({ error: error.message });
+    // Timeouts are reported separately so that the crawler can tell them apart:
+    // 504 for pages that didn't load, 422 for selectors that didn't appear
+    let status = 500;
+    if (error.name === "TimeoutError") {
+      status = 504;
+    } else if (error.name === "SelectorTimeoutError") {
+      status = 422;
+    }
+    res.status(status).json({ error: error.message, name: error.name });
   } finally {
     browserPool.releaseBrowser(browser);
   }
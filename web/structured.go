@@ -0,0 +1,347 @@
+package web
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rx3lixir/crawler/appconfig"
+)
+
+// structuredEvent is a schema.org Event found in the JSON-LD or microdata of a page.
+type structuredEvent struct {
+	Name        string
+	StartDate   string
+	EndDate     string
+	Location    string
+	URL         string
+	Price       string
+	Description string
+}
+
+// date returns the start date, or an ISO 8601 interval if the event has a different end.
+func (e structuredEvent) date() string {
+	if e.EndDate == "" || e.EndDate == e.StartDate || e.StartDate == "" {
+		return e.StartDate
+	}
+	return e.StartDate + "/" + e.EndDate
+}
+
+// structuredEvents returns the schema.org events described by JSON-LD on a page,
+// or by microdata if there is no JSON-LD event.
+func structuredEvents(doc *goquery.Document) []structuredEvent {
+	var events []structuredEvent
+	doc.Find(`script[type="application/ld+json"]`).Each(func(i int, s *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			log.Warnf("Error parsing JSON-LD block %d: %v", i, err)
+			return
+		}
+		events = appendEvents(events, data)
+	})
+	if len(events) > 0 {
+		return events
+	}
+
+	doc.Find("[itemscope][itemtype]").Each(func(i int, s *goquery.Selection) {
+		itemType, _ := s.Attr("itemtype")
+		if !isEventType(itemType) {
+			return
+		}
+		// Like in JSON-LD, events nested in an event are part of it
+		parentType, _ := s.Parent().Closest("[itemscope][itemtype]").Attr("itemtype")
+		if !isEventType(parentType) {
+			events = append(events, newStructuredEvent(microdataItem(s)))
+		}
+	})
+	return events
+}
+
+// appendEvents walks decoded JSON-LD and appends every Event, including the ones
+// inside @graph and lists. Events nested in an event, like sub-events, are skipped.
+func appendEvents(events []structuredEvent, data interface{}) []structuredEvent {
+	switch value := data.(type) {
+	case []interface{}:
+		for _, item := range value {
+			events = appendEvents(events, item)
+		}
+	case map[string]interface{}:
+		if isEventType(value["@type"]) {
+			return append(events, newStructuredEvent(value))
+		}
+		// Sorted keys keep the order of events stable between runs
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			events = appendEvents(events, value[key])
+		}
+	}
+	return events
+}
+
+// eventTypes are schema.org Event subtypes whose names don't end with "Event".
+var eventTypes = map[string]bool{
+	"Festival":       true,
+	"Hackathon":      true,
+	"EventSeries":    true,
+	"CourseInstance": true,
+}
+
+// isEventType reports whether a JSON-LD @type or a microdata itemtype names an Event.
+func isEventType(itemType interface{}) bool {
+	switch value := itemType.(type) {
+	case []interface{}:
+		for _, item := range value {
+			if isEventType(item) {
+				return true
+			}
+		}
+	case string:
+		// Full URLs and prefixed names, e.g. https://schema.org/MusicEvent or schema:Event
+		for _, name := range strings.Fields(value) {
+			if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+				name = name[i+1:]
+			}
+			if strings.HasSuffix(name, "Event") || eventTypes[name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newStructuredEvent(item map[string]interface{}) structuredEvent {
+	return structuredEvent{
+		Name:        jsonText(item["name"]),
+		StartDate:   jsonText(item["startDate"]),
+		EndDate:     jsonText(item["endDate"]),
+		Location:    locationText(item["location"]),
+		URL:         jsonText(item["url"]),
+		Price:       priceText(item["offers"]),
+		Description: jsonText(item["description"]),
+	}
+}
+
+// jsonText returns a JSON-LD value as text: the first non-empty element of a list,
+// the @value of a value object or the text of a string or number.
+func jsonText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		for _, item := range v {
+			if text := jsonText(item); text != "" {
+				return text
+			}
+		}
+	case map[string]interface{}:
+		if text := jsonText(v["@value"]); text != "" {
+			return text
+		}
+		return jsonText(v["@id"])
+	}
+	return ""
+}
+
+// locationText formats a Place as its name and address, or returns a plain location string.
+func locationText(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if text := locationText(item); text != "" {
+				return text
+			}
+		}
+	case map[string]interface{}:
+		parts := []string{jsonText(v["name"])}
+		switch address := v["address"].(type) {
+		case map[string]interface{}:
+			parts = append(parts, jsonText(address["streetAddress"]), jsonText(address["addressLocality"]))
+		default:
+			parts = append(parts, jsonText(address))
+		}
+		if text := joinDistinct(parts); text != "" {
+			return text
+		}
+		// Online events only have a URL
+		return jsonText(v["url"])
+	default:
+		return jsonText(v)
+	}
+	return ""
+}
+
+// priceText formats the first Offer as "price currency", using lowPrice for ranges.
+func priceText(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if text := priceText(item); text != "" {
+				return text
+			}
+		}
+	case map[string]interface{}:
+		price := jsonText(v["price"])
+		if low := jsonText(v["lowPrice"]); price == "" && low != "" {
+			price = low
+			if high := jsonText(v["highPrice"]); high != "" && high != low {
+				price += "–" + high
+			}
+		}
+		if price == "" {
+			return ""
+		}
+		return strings.TrimSpace(price + " " + jsonText(v["priceCurrency"]))
+	}
+	return ""
+}
+
+// joinDistinct joins the non-empty parts that aren't already contained in the previous ones.
+func joinDistinct(parts []string) string {
+	var result []string
+	joined := ""
+	for _, part := range parts {
+		if part == "" || strings.Contains(joined, part) {
+			continue
+		}
+		result = append(result, part)
+		joined = strings.Join(result, ", ")
+	}
+	return joined
+}
+
+// microdataItem converts an itemscope element into the shape of a JSON-LD object.
+// Only the first value of every property is kept.
+func microdataItem(scope *goquery.Selection) map[string]interface{} {
+	itemType, _ := scope.Attr("itemtype")
+	item := map[string]interface{}{"@type": itemType}
+
+	scope.Find("[itemprop]").Each(func(i int, s *goquery.Selection) {
+		// Properties of nested items belong to those items
+		if !s.Parent().Closest("[itemscope]").IsSelection(scope) {
+			return
+		}
+		var value interface{}
+		if _, nested := s.Attr("itemscope"); nested {
+			value = microdataItem(s)
+		} else {
+			value = microdataValue(s)
+		}
+		names, _ := s.Attr("itemprop")
+		for _, name := range strings.Fields(names) {
+			if _, exists := item[name]; !exists {
+				item[name] = value
+			}
+		}
+	})
+	return item
+}
+
+// microdataValue returns the value of a property element as defined by the HTML microdata spec.
+func microdataValue(s *goquery.Selection) string {
+	if content, ok := s.Attr("content"); ok {
+		return strings.TrimSpace(content)
+	}
+
+	attribute := ""
+	switch goquery.NodeName(s) {
+	case "a", "area", "link":
+		attribute = "href"
+	case "img", "audio", "video", "source", "iframe", "embed", "track":
+		attribute = "src"
+	case "time":
+		attribute = "datetime"
+	case "data", "meter":
+		attribute = "value"
+	}
+	if attribute != "" {
+		if value, ok := s.Attr(attribute); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
+// eventFromStructured builds an event of config from structured data found on pageURL.
+func eventFromStructured(config appconfig.SiteConfig, pageURL string, data structuredEvent) (appconfig.EventConfig, error) {
+	event := appconfig.EventConfig{
+		Title:       data.Name,
+		Date:        data.date(),
+		Location:    data.Location,
+		Link:        config.UrlToVisit,
+		EventType:   config.EventType,
+		Price:       data.Price,
+		Description: data.Description,
+		Source:      config.UrlToVisit,
+	}
+	if event.Location == "" {
+		event.Location = config.LocationSelector
+	}
+	if data.URL != "" {
+		link, err := resolveLink(pageURL, data.URL)
+		if err != nil {
+			return appconfig.EventConfig{}, err
+		}
+		event.Link = link
+	}
+	return event, nil
+}
+
+// fillFromStructured sets the empty fields of event from structured data.
+func fillFromStructured(config appconfig.SiteConfig, pageURL string, event *appconfig.EventConfig, data structuredEvent) {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&event.Title, data.Name)
+	fill(&event.Date, data.date())
+	fill(&event.Location, data.Location)
+	fill(&event.Price, data.Price)
+	fill(&event.Description, data.Description)
+
+	// The listing URL is the placeholder for events without a link of their own
+	if (event.Link == "" || event.Link == config.UrlToVisit) && data.URL != "" {
+		if link, err := resolveLink(pageURL, data.URL); err == nil {
+			event.Link = link
+		}
+	}
+}
+
+// matchStructured finds the structured event describing the same event as one
+// extracted by selectors: by link first, then by title.
+func matchStructured(config appconfig.SiteConfig, pageURL string, event appconfig.EventConfig, candidates []structuredEvent) (structuredEvent, bool) {
+	if event.Link != "" && event.Link != config.UrlToVisit {
+		for _, candidate := range candidates {
+			if candidate.URL == "" {
+				continue
+			}
+			if link, err := resolveLink(pageURL, candidate.URL); err == nil && sameURL(link, event.Link) {
+				return candidate, true
+			}
+		}
+	}
+	if title := normalizeTitle(event.Title); title != "" {
+		for _, candidate := range candidates {
+			if normalizeTitle(candidate.Name) == title {
+				return candidate, true
+			}
+		}
+	}
+	return structuredEvent{}, false
+}
+
+func sameURL(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+func normalizeTitle(title string) string {
+	return strings.Join(strings.Fields(strings.ToLower(title)), " ")
+}
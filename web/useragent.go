@@ -0,0 +1,43 @@
+package web
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rx3lixir/crawler/robots"
+)
+
+// DefaultUserAgent identifies the crawler when no user agent is configured.
+const DefaultUserAgent = "EventCrawler/1.0 (+https://github.com/rx3lixir/crawler)"
+
+type userAgentKey struct{}
+
+// withUserAgent stores the user agent that fetchers should send.
+func withUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentKey{}, userAgent)
+}
+
+// userAgentFrom returns the user agent stored in ctx, DefaultUserAgent if none.
+func userAgentFrom(ctx context.Context) string {
+	if userAgent, ok := ctx.Value(userAgentKey{}).(string); ok && userAgent != "" {
+		return userAgent
+	}
+	return DefaultUserAgent
+}
+
+// robotsCheckers keeps one robots.txt cache per user agent for the lifetime of the process.
+var robotsCheckers = struct {
+	mu   sync.Mutex
+	byUA map[string]*robots.Checker
+}{byUA: make(map[string]*robots.Checker)}
+
+func robotsChecker(userAgent string) *robots.Checker {
+	robotsCheckers.mu.Lock()
+	defer robotsCheckers.mu.Unlock()
+	checker, ok := robotsCheckers.byUA[userAgent]
+	if !ok {
+		checker = robots.NewChecker(userAgent)
+		robotsCheckers.byUA[userAgent] = checker
+	}
+	return checker
+}